@@ -7,6 +7,8 @@ require (
 	github.com/gofiber/fiber/v2 v2.52.2
 	github.com/mineatar-io/skin-render v1.3.0
 	github.com/redis/go-redis/v9 v9.5.1
+	golang.org/x/image v0.18.0
+	golang.org/x/sync v0.3.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+)
+
+var (
+	// AnimatedFormats is the list of formats that support encoding multiple frames.
+	AnimatedFormats []string = []string{"png", "gif"}
+	pngSignature    []byte   = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+)
+
+// pngChunk is a single chunk read from an encoded PNG image.
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+// EncodeAnimation encodes the frames into a looping animation of the format specified by the query parameters, where the PNG
+// format produces an APNG image. The delay is the amount of milliseconds that each frame is displayed for.
+func EncodeAnimation(frames []*image.NRGBA, delay int, opts *QueryParams) ([]byte, error) {
+	if len(frames) < 1 {
+		return nil, errors.New("animation: no frames to encode")
+	}
+
+	switch opts.Format {
+	case "png":
+		return encodeAPNG(frames, delay)
+	case "gif":
+		return encodeAnimatedGIF(frames, delay)
+	default:
+		return nil, fmt.Errorf("invalid animation format: %s", opts.Format)
+	}
+}
+
+// encodeAnimatedGIF encodes the frames into an animated GIF image with a single palette shared by all frames.
+func encodeAnimatedGIF(frames []*image.NRGBA, delay int) ([]byte, error) {
+	palette, indices, bits := getAnimationPalette(frames)
+
+	result := &gif.GIF{
+		Image:     make([]*image.Paletted, len(frames)),
+		Delay:     make([]int, len(frames)),
+		Disposal:  make([]byte, len(frames)),
+		LoopCount: 0,
+	}
+
+	for i, frame := range frames {
+		bounds := frame.Bounds()
+		paletted := image.NewPaletted(bounds, palette)
+
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				paletted.SetColorIndex(x, y, indices[quantizeColor(frame.NRGBAAt(x, y), bits)])
+			}
+		}
+
+		result.Image[i] = paletted
+		result.Delay[i] = Clamp(delay/10, 1, 65535)
+
+		// The frame area is cleared before the next frame is drawn, otherwise the previous frame shows through transparent pixels
+		result.Disposal[i] = gif.DisposalBackground
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := gif.EncodeAll(buf, result); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// getAnimationPalette returns a palette of at most 256 colors that contains every color used by the frames, with a transparent
+// color at index 0. If the frames use too many colors, the precision of each color channel is reduced until they fit. The
+// returned map contains the palette index of each quantized color, along with the amount of bits kept per color channel.
+func getAnimationPalette(frames []*image.NRGBA) (color.Palette, map[color.NRGBA]uint8, uint) {
+	for bits := uint(8); ; bits-- {
+		var (
+			palette color.Palette         = color.Palette{color.NRGBA{}}
+			indices map[color.NRGBA]uint8 = map[color.NRGBA]uint8{{}: 0}
+		)
+
+		for _, frame := range frames {
+			for i := 0; i < len(frame.Pix) && len(palette) <= 256; i += 4 {
+				c := quantizeColor(color.NRGBA{frame.Pix[i], frame.Pix[i+1], frame.Pix[i+2], frame.Pix[i+3]}, bits)
+
+				if _, ok := indices[c]; ok {
+					continue
+				}
+
+				if len(palette) < 256 {
+					indices[c] = uint8(len(palette))
+				}
+
+				palette = append(palette, c)
+			}
+		}
+
+		if len(palette) <= 256 {
+			return palette, indices, bits
+		}
+	}
+}
+
+// quantizeColor returns the color with only the most significant bits of each color channel kept. GIF images do not support
+// translucency, so mostly transparent colors become fully transparent and all other colors become fully opaque.
+func quantizeColor(c color.NRGBA, bits uint) color.NRGBA {
+	if c.A < 128 {
+		return color.NRGBA{}
+	}
+
+	mask := uint8(0xFF << (8 - bits))
+
+	return color.NRGBA{c.R & mask, c.G & mask, c.B & mask, 255}
+}
+
+// encodeAPNG encodes the frames into an animated PNG image. Every frame must be the same size. Each frame is encoded as a regular
+// PNG image, and the image data chunks are combined with the animation control chunks into a single image.
+func encodeAPNG(frames []*image.NRGBA, delay int) ([]byte, error) {
+	var (
+		buf      *bytes.Buffer = &bytes.Buffer{}
+		header   []byte        = nil
+		sequence uint32        = 0
+	)
+
+	buf.Write(pngSignature)
+
+	for i, frame := range frames {
+		data, err := EncodePNG(frame)
+
+		if err != nil {
+			return nil, err
+		}
+
+		chunks, err := readPNGChunks(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, chunk := range chunks {
+			switch chunk.Type {
+			case "IHDR":
+				{
+					if header == nil {
+						header = chunk.Data
+
+						writePNGChunk(buf, "IHDR", header)
+
+						// acTL: number of frames, number of plays (0 = infinite)
+						writePNGChunk(buf, "acTL", appendUint32(appendUint32(nil, uint32(len(frames))), 0))
+					} else if !bytes.Equal(header, chunk.Data) {
+						return nil, errors.New("animation: all frames must share the same size and color type")
+					}
+
+					// fcTL: sequence number, width, height, x offset, y offset, delay numerator, delay denominator, dispose op, blend op
+					control := appendUint32(nil, sequence)
+					control = append(control, chunk.Data[0:8]...)
+					control = appendUint32(control, 0)
+					control = appendUint32(control, 0)
+					control = appendUint16(control, uint16(Clamp(delay, 1, 65535)))
+					control = appendUint16(control, 1000)
+					control = append(control, 1, 0)
+
+					writePNGChunk(buf, "fcTL", control)
+
+					sequence++
+
+					break
+				}
+			case "IDAT":
+				{
+					// The first frame doubles as the default image, every other frame is stored in fdAT chunks
+					if i == 0 {
+						writePNGChunk(buf, "IDAT", chunk.Data)
+
+						break
+					}
+
+					writePNGChunk(buf, "fdAT", append(appendUint32(nil, sequence), chunk.Data...))
+
+					sequence++
+
+					break
+				}
+			}
+		}
+	}
+
+	writePNGChunk(buf, "IEND", nil)
+
+	return buf.Bytes(), nil
+}
+
+// readPNGChunks reads all chunks from the encoded PNG image.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("animation: invalid PNG signature")
+	}
+
+	result := make([]pngChunk, 0)
+
+	for offset := len(pngSignature); offset < len(data); {
+		if offset+8 > len(data) {
+			return nil, errors.New("animation: unexpected end of PNG data")
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+
+		if offset+12+length > len(data) {
+			return nil, errors.New("animation: unexpected end of PNG data")
+		}
+
+		result = append(result, pngChunk{
+			Type: string(data[offset+4 : offset+8]),
+			Data: data[offset+8 : offset+8+length],
+		})
+
+		offset += 12 + length
+	}
+
+	return result, nil
+}
+
+// writePNGChunk writes a single chunk, including the length and checksum, to the buffer.
+func writePNGChunk(buf *bytes.Buffer, chunkType string, data []byte) {
+	checksum := crc32.NewIEEE()
+	checksum.Write([]byte(chunkType))
+	checksum.Write(data)
+
+	buf.Write(appendUint32(nil, uint32(len(data))))
+	buf.WriteString(chunkType)
+	buf.Write(data)
+	buf.Write(checksum.Sum(nil))
+}
+
+// appendUint32 appends the big-endian representation of the value to the byte array.
+func appendUint32(data []byte, value uint32) []byte {
+	return append(data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+// appendUint16 appends the big-endian representation of the value to the byte array.
+func appendUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value>>8), byte(value))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// testFrames returns the frames of an animation, each filled with a different color.
+func testFrames(count, width, height int) []*image.NRGBA {
+	frames := make([]*image.NRGBA, count)
+
+	for i := range frames {
+		frames[i] = image.NewNRGBA(image.Rect(0, 0, width, height))
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				frames[i].SetNRGBA(x, y, color.NRGBA{uint8(i * 40), uint8(x * 10), uint8(y * 10), 255})
+			}
+		}
+	}
+
+	return frames
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	tests := []struct {
+		name          string
+		frames        int
+		delay         int
+		expectedDelay uint16
+	}{
+		{name: "single frame", frames: 1, delay: 50, expectedDelay: 50},
+		{name: "multiple frames", frames: 3, delay: 100, expectedDelay: 100},
+		{name: "zero delay", frames: 2, delay: 0, expectedDelay: 1},
+		{name: "long delay", frames: 2, delay: 100000, expectedDelay: 65535},
+	}
+
+	for _, test := range tests {
+		frames := testFrames(test.frames, 8, 5)
+
+		data, err := encodeAPNG(frames, test.delay)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		// Decoders without animation support show the first frame, and the checksum of every chunk is verified
+		decoded, err := png.Decode(bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatalf("%s: decode: %v", test.name, err)
+		}
+
+		if decoded.Bounds() != frames[0].Bounds() {
+			t.Fatalf("%s: default image bounds %v", test.name, decoded.Bounds())
+		}
+
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 8; x++ {
+				if actual := color.NRGBAModel.Convert(decoded.At(x, y)); actual != frames[0].NRGBAAt(x, y) {
+					t.Fatalf("%s: default image pixel (%d, %d) is %v, expected the first frame", test.name, x, y, actual)
+				}
+			}
+		}
+
+		chunks, err := readPNGChunks(data)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		var (
+			types    []string = make([]string, 0, len(chunks))
+			expected []string = []string{"IHDR", "acTL", "fcTL", "IDAT"}
+			sequence uint32   = 0
+		)
+
+		for i := 1; i < test.frames; i++ {
+			expected = append(expected, "fcTL", "fdAT")
+		}
+
+		expected = append(expected, "IEND")
+
+		for _, chunk := range chunks {
+			types = append(types, chunk.Type)
+
+			switch chunk.Type {
+			case "acTL":
+				{
+					if frameCount := binary.BigEndian.Uint32(chunk.Data); frameCount != uint32(test.frames) {
+						t.Fatalf("%s: acTL has %d frames, expected %d", test.name, frameCount, test.frames)
+					}
+
+					break
+				}
+			case "fcTL", "fdAT":
+				{
+					// The fcTL and fdAT chunks share a single sequence starting from zero
+					if value := binary.BigEndian.Uint32(chunk.Data); value != sequence {
+						t.Fatalf("%s: %s has sequence number %d, expected %d", test.name, chunk.Type, value, sequence)
+					}
+
+					sequence++
+
+					if chunk.Type == "fcTL" {
+						if delay := binary.BigEndian.Uint16(chunk.Data[20:]); delay != test.expectedDelay {
+							t.Fatalf("%s: fcTL has delay %d, expected %d", test.name, delay, test.expectedDelay)
+						}
+
+						if denominator := binary.BigEndian.Uint16(chunk.Data[22:]); denominator != 1000 {
+							t.Fatalf("%s: fcTL has delay denominator %d", test.name, denominator)
+						}
+					}
+
+					break
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(types, expected) {
+			t.Fatalf("%s: chunks %v, expected %v", test.name, types, expected)
+		}
+	}
+}
+
+func TestEncodeAPNGDifferentSizes(t *testing.T) {
+	frames := append(testFrames(1, 8, 5), testFrames(1, 5, 8)...)
+
+	if _, err := encodeAPNG(frames, 50); err == nil {
+		t.Fatal("expected an error for frames of different sizes")
+	}
+}
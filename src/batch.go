@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+var (
+	// batchWorkers is the semaphore shared by every batch and sprite sheet request, which is created by getBatchWorkers.
+	batchWorkers     chan struct{} = nil
+	batchWorkersOnce sync.Once     = sync.Once{}
+)
+
+// BatchRequest is the body of a request to the batch render route.
+type BatchRequest struct {
+	Players []string `json:"players"`
+}
+
+// BatchResponse is the JSON body of a response from the batch render route, where every map is keyed by the players as they
+// were given in the request. The fallbacks contain the players whose image used a fallback skin, as the skin provider failed.
+type BatchResponse struct {
+	Images    map[string]string `json:"images"`
+	Errors    map[string]string `json:"errors"`
+	Fallbacks map[string]string `json:"fallbacks"`
+}
+
+// BatchResult is the result of rendering a single player of a batch request, where either the data or the error is set. The
+// fallback is set when the data used a fallback skin.
+type BatchResult struct {
+	Player   string
+	UUID     string
+	Data     []byte
+	Fallback string
+	Error    string
+}
+
+// BatchHandler is the API handler used for the `/batch/:type` route, where the type is a render type such as `face` or `fullbody`.
+func BatchHandler(ctx *fiber.Ctx) error {
+	renderType, opts := ParseRenderTypeParams(ctx)
+
+	if opts == nil {
+		return nil
+	}
+
+	var body BatchRequest
+
+	if err := json.Unmarshal(ctx.Body(), &body); err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid request body")
+	}
+
+	// The amount of players is checked before removing duplicates, so the work done for a request is bounded by the maximum
+	if len(body.Players) > config.Routes.Batch.MaxPlayers {
+		return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Too many players, the maximum is %d", config.Routes.Batch.MaxPlayers))
+	}
+
+	// Remove duplicate players so each one is only rendered once
+	var (
+		players []string            = make([]string, 0, len(body.Players))
+		seen    map[string]struct{} = make(map[string]struct{}, len(body.Players))
+	)
+
+	for _, player := range body.Players {
+		if _, ok := seen[player]; ok {
+			continue
+		}
+
+		seen[player] = struct{}{}
+		players = append(players, player)
+	}
+
+	if len(players) < 1 {
+		return ctx.Status(http.StatusBadRequest).SendString("No players were provided")
+	}
+
+	results := RenderBatch(renderType, players, opts)
+
+	if ctx.Accepts(fiber.MIMEApplicationJSON, "multipart/mixed") == "multipart/mixed" {
+		return sendBatchMultipart(ctx, results, opts)
+	}
+
+	response := BatchResponse{
+		Images:    make(map[string]string),
+		Errors:    make(map[string]string),
+		Fallbacks: make(map[string]string),
+	}
+
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			response.Errors[result.Player] = result.Error
+
+			continue
+		}
+
+		response.Images[result.Player] = base64.StdEncoding.EncodeToString(result.Data)
+
+		if len(result.Fallback) > 0 {
+			response.Fallbacks[result.Player] = result.Fallback
+		}
+	}
+
+	return ctx.JSON(response)
+}
+
+// RenderBatch renders every player concurrently using a bounded amount of workers, returning the results in the same order as
+// the players. Errors are reported per player so that a single failure does not fail the whole batch.
+func RenderBatch(renderType string, players []string, opts *QueryParams) []*BatchResult {
+	results := make([]*BatchResult, len(players))
+
+	runConcurrently(len(players), func(index int) {
+		results[index] = renderBatchPlayer(renderType, players[index], opts)
+	})
+
+	return results
+}
+
+// runConcurrently calls the function once for every index up to the count, and returns after all calls have completed. The
+// calls of every request share the same workers, so concurrent requests do not multiply the amount of players rendered at
+// the same time.
+func runConcurrently(count int, fn func(index int)) {
+	var (
+		workers chan struct{}  = getBatchWorkers()
+		wg      sync.WaitGroup = sync.WaitGroup{}
+	)
+
+	for index := 0; index < count; index++ {
+		wg.Add(1)
+
+		go func(index int) {
+			defer wg.Done()
+
+			workers <- struct{}{}
+
+			defer func() { <-workers }()
+
+			fn(index)
+		}(index)
+	}
+
+	wg.Wait()
+}
+
+// getBatchWorkers returns the semaphore limiting the amount of players rendered at the same time by the whole process, which is
+// created from the configuration on first use.
+func getBatchWorkers() chan struct{} {
+	batchWorkersOnce.Do(func() {
+		workers := config.Routes.Batch.Workers
+
+		if workers < 1 {
+			workers = 1
+		}
+
+		batchWorkers = make(chan struct{}, workers)
+	})
+
+	return batchWorkers
+}
+
+// renderBatchPlayer resolves and renders a single player of a batch request, reusing the same caches as the individual routes.
+func renderBatchPlayer(renderType, player string, opts *QueryParams) *BatchResult {
+	result := &BatchResult{Player: player}
+
+	uuid, err := ResolvePlayer(player, opts.Provider)
+
+	if err != nil {
+		result.Error = playerError(player, err)
+
+		return result
+	}
+
+	result.UUID = uuid
+
+	rawSkin, isSlim, textureHash, fallback, err := GetPlayerSkin(uuid, opts.Provider)
+
+	if err != nil {
+		result.Error = playerError(player, err)
+
+		return result
+	}
+
+	rawCape, fallback := GetRenderCape(uuid, fallback, opts)
+
+	result.Fallback = fallback
+
+	if result.Data, _, err = Render(renderType, GetResultCacheKey(uuid, renderType, textureHash, isSlim, opts), rawSkin, isSlim, rawCape, fallback, opts); err != nil {
+		result.Error = playerError(player, err)
+	}
+
+	return result
+}
+
+// playerError returns the message sent to the client in place of the error that occurred while rendering a player of a batch
+// request or sprite sheet, logging the error if it was unexpected.
+func playerError(player string, err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidPlayer):
+		return "Invalid UUID or username"
+	case errors.Is(err, ErrUnknownPlayer):
+		return "Unknown player"
+	default:
+		log.Printf("Error: failed to render %s: %v\n", player, err)
+
+		return "Internal server error"
+	}
+}
+
+// sendBatchMultipart sends the results of a batch request as a multipart response, with one part per player. Failed players are
+// sent as plain text parts containing the error message, and images that used a fallback skin have an X-Skin-Fallback header.
+func sendBatchMultipart(ctx *fiber.Ctx, results []*BatchResult, opts *QueryParams) error {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	for _, result := range results {
+		header := textproto.MIMEHeader{}
+
+		// The player is quoted by the media type formatter, as it is an arbitrary value from the request body
+		if len(result.Error) > 0 {
+			header.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			header.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"name": result.Player}))
+		} else {
+			header.Set(fiber.HeaderContentType, utils.GetMIME(opts.Format))
+			header.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{
+				"name":     result.Player,
+				"filename": fmt.Sprintf("%s.%s", result.UUID, opts.Format),
+			}))
+			header.Set("X-Player-UUID", result.UUID)
+
+			if len(result.Fallback) > 0 {
+				header.Set("X-Skin-Fallback", result.Fallback)
+			}
+		}
+
+		part, err := writer.CreatePart(header)
+
+		if err != nil {
+			return err
+		}
+
+		if len(result.Error) > 0 {
+			_, err = part.Write([]byte(result.Error))
+		} else {
+			_, err = part.Write(result.Data)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, fmt.Sprintf("multipart/mixed; boundary=%s", writer.Boundary()))
+
+	return ctx.Send(buf.Bytes())
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ResultCacheKey struct {
@@ -14,67 +17,168 @@ type ResultCacheKey struct {
 	Overlay bool   `json:"overlay"`
 }
 
-// GetCacheKey returns the key used in the cache based on the rendering options, calculated as an SHA-256 hash.
-func GetResultCacheKey(uuid, renderType string, opts *QueryParams) string {
+// GetCacheKey returns the key used in the cache based on the rendering options, calculated as an SHA-256 hash. Results are keyed
+// by the texture hash of the skin instead of the player, so players wearing the same skin share the same results and a skin
+// change uses new results. The player is only part of the key when there is no texture hash, or when the cape is rendered.
+func GetResultCacheKey(uuid, renderType, textureHash string, isSlim bool, opts *QueryParams) string {
 	values := &url.Values{}
-	values.Set("uuid", uuid)
+
+	if len(textureHash) < 1 || opts.Cape || opts.Elytra {
+		values.Set("uuid", GetPlayerCacheID(uuid, opts.Provider))
+	}
+
+	values.Set("texture", textureHash)
+	values.Set("slim", strconv.FormatBool(isSlim))
 	values.Set("type", renderType)
 	values.Set("scale", strconv.FormatInt(int64(opts.Scale), 10))
 	values.Set("overlay", strconv.FormatBool(opts.Overlay))
 	values.Set("format", opts.Format)
 	values.Set("square", strconv.FormatBool(opts.Square))
+	values.Set("yaw", strconv.FormatInt(int64(opts.Yaw), 10))
+	values.Set("pitch", strconv.FormatInt(int64(opts.Pitch), 10))
+	values.Set("pose", fmt.Sprint(opts.Pose))
+	values.Set("cape", strconv.FormatBool(opts.Cape))
+	values.Set("elytra", strconv.FormatBool(opts.Elytra))
+	values.Set("spread", strconv.FormatBool(opts.Spread))
+	values.Set("frames", strconv.FormatInt(int64(opts.Frames), 10))
+	values.Set("delay", strconv.FormatInt(int64(opts.Delay), 10))
+	values.Set("quality", strconv.FormatInt(int64(opts.Quality), 10))
+	values.Set("lossless", strconv.FormatBool(opts.Lossless))
+
+	return SHA256(values.Encode())
+}
+
+// GetSheetResultCacheKey returns the key used in the cache for a sprite sheet, calculated as an SHA-256 hash of the options, the
+// layout, and the texture of each cell so that a skin change of any player uses a new result.
+func GetSheetResultCacheKey(renderType string, opts *QueryParams, sheet *SheetParams, cells []*SheetCell, skins []*sheetSkin) string {
+	values := &url.Values{}
+
+	values.Set("type", renderType)
+	values.Set("scale", strconv.FormatInt(int64(opts.Scale), 10))
+	values.Set("overlay", strconv.FormatBool(opts.Overlay))
+	values.Set("format", opts.Format)
+	values.Set("square", strconv.FormatBool(opts.Square))
+	values.Set("quality", strconv.FormatInt(int64(opts.Quality), 10))
+	values.Set("lossless", strconv.FormatBool(opts.Lossless))
+	values.Set("columns", strconv.FormatInt(int64(sheet.Columns), 10))
+	values.Set("padding", strconv.FormatInt(int64(sheet.Padding), 10))
+	values.Set("background", fmt.Sprintf("%02x%02x%02x%02x", sheet.Background.R, sheet.Background.G, sheet.Background.B, sheet.Background.A))
+
+	// Cells are added in order, and cells of players that failed to resolve use the error, so a sheet with a player that failed
+	// temporarily does not share the result of the sheet once the player resolves
+	for index, cellSkin := range skins {
+		if cellSkin == nil {
+			values.Add("cell", fmt.Sprintf("error:%s", cells[index].Error))
+
+			continue
+		}
+
+		values.Add("cell", fmt.Sprintf("%s:%t", cellSkin.TextureHash, cellSkin.Slim))
+	}
 
 	return SHA256(values.Encode())
 }
 
 // GetCachedRenderResult returns the render result from Redis cache, or nil if it does not exist or cache is disabled.
-func GetCachedRenderResult(renderType, uuid string, opts *QueryParams) ([]byte, error) {
+func GetCachedRenderResult(resultKey string) ([]byte, error) {
 	if config.Cache.RenderCacheDuration == nil {
 		return nil, nil
 	}
 
-	data, _, err := s.GetBytes(fmt.Sprintf("result:%s", GetResultCacheKey(uuid, renderType, opts)))
+	data, _, err := s.GetBytes(fmt.Sprintf("result:%s", resultKey))
 
 	return data, err
 }
 
 // SetCachedRenderResult puts the render result into cache, or does nothing is cache is disabled.
-func SetCachedRenderResult(renderType, uuid string, opts *QueryParams, data []byte) error {
+func SetCachedRenderResult(resultKey string, data []byte) error {
 	if config.Cache.RenderCacheDuration == nil {
 		return nil
 	}
 
-	return s.SetBytes(fmt.Sprintf("result:%s", GetResultCacheKey(uuid, renderType, opts)), data, *config.Cache.RenderCacheDuration)
+	return s.SetBytes(fmt.Sprintf("result:%s", resultKey), data, *config.Cache.RenderCacheDuration)
+}
+
+// GetCachedRenderResultTTL returns the remaining time of the render result in the cache, and if it exists.
+func GetCachedRenderResultTTL(resultKey string) (time.Duration, bool, error) {
+	if config.Cache.RenderCacheDuration == nil {
+		return 0, false, nil
+	}
+
+	return s.TTL(fmt.Sprintf("result:%s", resultKey))
 }
 
-// GetCachedSkin returns the raw skin of a player by UUID from the cache, also returning if the player has a slim player model.
-func GetCachedSkin(uuid string) (*image.NRGBA, bool, error) {
-	cache, ok, err := s.GetNRGBA(fmt.Sprintf("skin:%s", uuid))
+// GetCachedSkin returns the raw skin of a player by UUID from the cache by following the pointer to the texture hash of the skin,
+// also returning if the player has a slim player model and the texture hash.
+func GetCachedSkin(uuid string) (*image.NRGBA, bool, string, error) {
+	textureHash, err := GetCachedSkinHash(uuid)
+
+	if err != nil || len(textureHash) < 1 {
+		return nil, false, "", err
+	}
+
+	cache, ok, err := GetCachedTexture(textureHash)
+
+	// The texture may have expired before the pointer to it, in which case the skin is fetched again
+	if err != nil || !ok {
+		return nil, false, "", err
+	}
+
+	slim, err := s.Exists(fmt.Sprintf("slim:%s", uuid))
 
 	if err != nil {
-		return nil, false, err
+		return nil, false, "", err
 	}
 
-	if ok {
-		slim, err := s.Exists(fmt.Sprintf("slim:%s", uuid))
+	return cache, slim, textureHash, nil
+}
 
-		if err != nil {
-			return nil, false, err
-		}
+// GetCachedSkinHash returns the texture hash of the skin of a player by UUID from the cache, or an empty string if it does not
+// exist.
+func GetCachedSkinHash(uuid string) (string, error) {
+	data, ok, err := s.GetBytes(fmt.Sprintf("skin-hash:%s", uuid))
 
-		return cache, slim, nil
+	if err != nil || !ok {
+		return "", err
 	}
 
-	return nil, false, nil
+	return string(data), nil
 }
 
-func SetCachedSkin(uuid string, value []byte, isSlim bool) error {
-	if err := s.SetBytes(fmt.Sprintf("skin:%s", uuid), value, *config.Cache.SkinCacheDuration); err != nil {
+// GetCachedTexture returns the raw skin by its texture hash from the cache, and if it exists.
+func GetCachedTexture(textureHash string) (*image.NRGBA, bool, error) {
+	return s.GetNRGBA(fmt.Sprintf("skin:%s", textureHash))
+}
+
+// SetCachedSkin puts the raw skin into the cache by its texture hash, along with the pointer from the UUID of the player to the
+// texture hash. Players wearing the same skin share the same cached texture.
+func SetCachedSkin(uuid, textureHash string, value []byte, isSlim bool) error {
+	ttl := GetSkinCacheTTL()
+
+	// The texture is written even if it already exists so that it does not expire before either pointer to it
+	if err := s.SetBytes(fmt.Sprintf("skin:%s", textureHash), value, ttl+getSkinFallbackDuration()); err != nil {
+		return err
+	}
+
+	// The fallback pointer outlives the skin so that the last known skin can be served when the skin provider fails
+	if config.Cache.SkinFallbackDuration != nil {
+		fallback := fmt.Sprintf("%s:%s", textureHash, strconv.FormatBool(isSlim))
+
+		if err := s.SetBytes(fmt.Sprintf("skin-fallback:%s", uuid), []byte(fallback), ttl+*config.Cache.SkinFallbackDuration); err != nil {
+			return err
+		}
+	}
+
+	if err := s.SetBytes(fmt.Sprintf("skin-hash:%s", uuid), []byte(textureHash), ttl); err != nil {
+		return err
+	}
+
+	if err := setCachedTime(fmt.Sprintf("skin-hash:%s", uuid), ttl); err != nil {
 		return err
 	}
 
 	if isSlim {
-		if err := s.SetBytes(fmt.Sprintf("slim:%s", uuid), []byte("true"), *config.Cache.SkinCacheDuration); err != nil {
+		if err := s.SetBytes(fmt.Sprintf("slim:%s", uuid), []byte("true"), ttl); err != nil {
 			return err
 		}
 	} else {
@@ -85,3 +189,181 @@ func SetCachedSkin(uuid string, value []byte, isSlim bool) error {
 
 	return nil
 }
+
+// GetFallbackSkin returns the last known skin of a player by UUID from the cache, which is retained for longer than the skin
+// itself, also returning if the player has a slim player model and the texture hash. A nil image is returned if the skin is no
+// longer retained.
+func GetFallbackSkin(uuid string) (*image.NRGBA, bool, string, error) {
+	if config.Cache.SkinFallbackDuration == nil {
+		return nil, false, "", nil
+	}
+
+	data, ok, err := s.GetBytes(fmt.Sprintf("skin-fallback:%s", uuid))
+
+	if err != nil || !ok {
+		return nil, false, "", err
+	}
+
+	textureHash, rawSlim, _ := strings.Cut(string(data), ":")
+
+	cache, ok, err := GetCachedTexture(textureHash)
+
+	if err != nil || !ok {
+		return nil, false, "", err
+	}
+
+	slim, _ := strconv.ParseBool(rawSlim)
+
+	return cache, slim, textureHash, nil
+}
+
+// getSkinFallbackDuration returns how long skins are retained after they expire to be served when the skin provider fails.
+func getSkinFallbackDuration() time.Duration {
+	if config.Cache.SkinFallbackDuration == nil {
+		return 0
+	}
+
+	return *config.Cache.SkinFallbackDuration
+}
+
+// GetSkinCacheTTL returns how long skins are kept in the cache, which includes the time they are served while stale.
+func GetSkinCacheTTL() time.Duration {
+	if config.Cache.SkinStaleDuration == nil {
+		return *config.Cache.SkinCacheDuration
+	}
+
+	return *config.Cache.SkinCacheDuration + *config.Cache.SkinStaleDuration
+}
+
+// IsCachedSkinStale returns true if the skin of a player was put into the cache longer ago than the skin cache duration, and
+// stale skins are enabled. Skins with an unknown cache time are never stale.
+func IsCachedSkinStale(uuid string) (bool, error) {
+	if config.Cache.SkinCacheDuration == nil || config.Cache.SkinStaleDuration == nil {
+		return false, nil
+	}
+
+	cachedAt, err := GetCachedSkinTime(uuid)
+
+	if err != nil || cachedAt.IsZero() {
+		return false, err
+	}
+
+	return time.Since(cachedAt) > *config.Cache.SkinCacheDuration, nil
+}
+
+// GetCachedUUID returns the UUID of a player by their username from the cache, also returning if the username exists in the
+// cache. An empty UUID is returned when the username is known to not belong to any player.
+func GetCachedUUID(username string) (string, bool, error) {
+	if config.Cache.UUIDCacheDuration == nil {
+		return "", false, nil
+	}
+
+	data, ok, err := s.GetBytes(fmt.Sprintf("uuid:%s", strings.ToLower(username)))
+
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	return string(data), true, nil
+}
+
+// SetCachedUUID puts the UUID of a player by their username into the cache, or does nothing if cache is disabled. An empty UUID
+// marks the username as unknown, which is only cached for the unknown UUID duration so that newly registered usernames are found.
+func SetCachedUUID(username, uuid string) error {
+	if config.Cache.UUIDCacheDuration == nil {
+		return nil
+	}
+
+	ttl := *config.Cache.UUIDCacheDuration
+
+	if len(uuid) < 1 {
+		// A missing or zero duration disables the negative cache, as the store would keep the value forever
+		if config.Cache.UnknownUUIDDuration == nil || *config.Cache.UnknownUUIDDuration <= 0 {
+			return nil
+		}
+
+		ttl = *config.Cache.UnknownUUIDDuration
+	}
+
+	return s.SetBytes(fmt.Sprintf("uuid:%s", strings.ToLower(username)), []byte(uuid), ttl)
+}
+
+// GetCachedCape returns the cape of a player by UUID from the cache, also returning if the cape of the player exists in the cache.
+// A nil image is returned when the player is known to not have a cape.
+func GetCachedCape(uuid string) (*image.NRGBA, bool, error) {
+	data, ok, err := s.GetBytes(fmt.Sprintf("cape:%s", uuid))
+
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	if len(data) < 1 {
+		return nil, true, nil
+	}
+
+	cape, err := DecodeImage(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return cape, true, nil
+}
+
+// SetCachedCape puts the raw cape of a player into the cache, where an empty value means the player does not have a cape.
+func SetCachedCape(uuid string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+
+	if err := s.SetBytes(fmt.Sprintf("cape:%s", uuid), value, *config.Cache.SkinCacheDuration); err != nil {
+		return err
+	}
+
+	return setCachedTime(fmt.Sprintf("cape:%s", uuid), *config.Cache.SkinCacheDuration)
+}
+
+// GetCachedCapeURL returns the URL of the cape of a player from the cache, which is cached when the skin of the player is fetched.
+// An empty URL means the player does not have a cape.
+func GetCachedCapeURL(uuid string) (string, bool, error) {
+	data, ok, err := s.GetBytes(fmt.Sprintf("cape-url:%s", uuid))
+
+	return string(data), ok, err
+}
+
+// SetCachedCapeURL puts the URL of the cape of a player into the cache, where an empty URL means the player does not have a cape.
+func SetCachedCapeURL(uuid, capeURL string) error {
+	return s.SetBytes(fmt.Sprintf("cape-url:%s", uuid), []byte(capeURL), *config.Cache.SkinCacheDuration)
+}
+
+// GetCachedSkinTime returns the time the skin of a player was put into the cache, or the zero time if it is not cached.
+func GetCachedSkinTime(uuid string) (time.Time, error) {
+	return getCachedTime(fmt.Sprintf("skin-hash:%s", uuid))
+}
+
+// GetCachedCapeTime returns the time the cape of a player was put into the cache, or the zero time if it is not cached.
+func GetCachedCapeTime(uuid string) (time.Time, error) {
+	return getCachedTime(fmt.Sprintf("cape:%s", uuid))
+}
+
+// getCachedTime returns the time the value of the key was put into the cache, or the zero time if it is unknown.
+func getCachedTime(key string) (time.Time, error) {
+	data, ok, err := s.GetBytes(fmt.Sprintf("time:%s", key))
+
+	if err != nil || !ok {
+		return time.Time{}, err
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+
+	if err != nil {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(value, 0), nil
+}
+
+// setCachedTime puts the current time into the cache alongside the value of the key, using the same TTL as the value.
+func setCachedTime(key string, ttl time.Duration) error {
+	return s.SetBytes(fmt.Sprintf("time:%s", key), []byte(strconv.FormatInt(time.Now().Unix(), 10)), ttl)
+}
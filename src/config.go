@@ -8,12 +8,22 @@ import (
 )
 
 var (
-	// DefaultConfig is the default configuration values used by the application.
+	// DefaultConfig is the default configuration values used by the application, which are used for every value that is missing
+	// from the configuration file.
 	DefaultConfig *Config = &Config{
 		Environment: "development",
 		Host:        "127.0.0.1",
 		Port:        3001,
 		Redis:       "redis://127.0.0.1:6379/0",
+		Mojang: MojangConfig{
+			SessionServer: DefaultSessionServer,
+			API:           DefaultMojangAPI,
+			TextureHost:   "",
+			RateLimit: RateLimitConfig{
+				MaxQueue: 100,
+				Timeout:  time.Second * 2,
+			},
+		},
 		Routes: Routes{
 			Face: RouteConfig{
 				DefaultOverlay:  true,
@@ -78,14 +88,88 @@ var (
 				MaxScale:        64,
 				DefaultFormat:   "png",
 			},
+			Body3D: CameraRouteConfig{
+				RouteConfig: RouteConfig{
+					DefaultOverlay:  true,
+					DefaultDownload: false,
+					DefaultScale:    4,
+					DefaultSquare:   false,
+					MinScale:        1,
+					MaxScale:        64,
+					DefaultFormat:   "png",
+				},
+				DefaultYaw:   30,
+				DefaultPitch: 15,
+			},
+			Head3D: CameraRouteConfig{
+				RouteConfig: RouteConfig{
+					DefaultOverlay:  true,
+					DefaultDownload: false,
+					DefaultScale:    4,
+					DefaultSquare:   false,
+					MinScale:        1,
+					MaxScale:        64,
+					DefaultFormat:   "png",
+				},
+				DefaultYaw:   30,
+				DefaultPitch: 15,
+			},
+			Turntable: TurntableRouteConfig{
+				CameraRouteConfig: CameraRouteConfig{
+					RouteConfig: RouteConfig{
+						DefaultOverlay:  true,
+						DefaultDownload: false,
+						DefaultScale:    4,
+						DefaultSquare:   false,
+						MinScale:        1,
+						MaxScale:        16,
+						DefaultFormat:   "gif",
+					},
+					DefaultYaw:   0,
+					DefaultPitch: 15,
+				},
+				DefaultFrames: 24,
+				MaxFrames:     72,
+				DefaultDelay:  60,
+				MinDelay:      20,
+				MaxDelay:      1000,
+			},
 			RawSkin: RouteConfig{
 				DefaultDownload: false,
 				DefaultFormat:   "png",
 			},
+			RawCape: RouteConfig{
+				DefaultDownload: false,
+				DefaultFormat:   "png",
+			},
+			Batch: BatchRouteConfig{
+				MaxPlayers: 100,
+				Workers:    8,
+			},
+			Sheet: SheetRouteConfig{
+				RouteConfig: RouteConfig{
+					DefaultOverlay:  true,
+					DefaultDownload: false,
+					DefaultScale:    4,
+					DefaultSquare:   false,
+					MinScale:        1,
+					MaxScale:        16,
+					DefaultFormat:   "png",
+				},
+				MaxPlayers:     100,
+				DefaultColumns: 10,
+				MaxPadding:     64,
+			},
+			CustomSkin: CustomSkinRouteConfig{
+				AllowedHosts: []string{"textures.minecraft.net"},
+				MaxSize:      1024 * 1024,
+			},
 		},
 		Cache: CacheConfig{
 			SkinCacheDuration:   PointerOf(time.Hour * 12),
 			RenderCacheDuration: PointerOf(time.Hour * 12),
+			UUIDCacheDuration:   PointerOf(time.Hour * 12),
+			UnknownUUIDDuration: PointerOf(time.Minute * 5),
 			EnableLocks:         true,
 		},
 	}
@@ -93,24 +177,52 @@ var (
 
 // Config is the root configuration object for the application.
 type Config struct {
-	Environment string      `yaml:"environment"`
-	Host        string      `yaml:"host"`
-	Port        uint16      `yaml:"port"`
-	Redis       string      `yaml:"redis"`
-	Routes      Routes      `yaml:"routes"`
-	Cache       CacheConfig `yaml:"cache"`
+	Environment string                   `yaml:"environment"`
+	Host        string                   `yaml:"host"`
+	Port        uint16                   `yaml:"port"`
+	Redis       string                   `yaml:"redis"`
+	Mojang      MojangConfig             `yaml:"mojang"`
+	Providers   []map[string]interface{} `yaml:"providers"`
+	Routes      Routes                   `yaml:"routes"`
+	Cache       CacheConfig              `yaml:"cache"`
+}
+
+// MojangConfig is the configuration data of the upstream servers that player profiles and textures are fetched from, which
+// default to the servers of Mojang. The texture host replaces the scheme and host of the texture URLs within profiles.
+type MojangConfig struct {
+	SessionServer string          `yaml:"session_server"`
+	API           string          `yaml:"api"`
+	TextureHost   string          `yaml:"texture_host"`
+	RateLimit     RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig is the configuration data of the rate limit of requests to the session server, which is shared by every
+// process. The rate limit is disabled if there are no requests per interval.
+type RateLimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Interval time.Duration `yaml:"interval"`
+	Burst    int           `yaml:"burst"`
+	MaxQueue int           `yaml:"max_queue"`
+	Timeout  time.Duration `yaml:"timeout"`
 }
 
 // Routes is the configuration data of all API routes.
 type Routes struct {
-	Face      RouteConfig `yaml:"face"`
-	Head      RouteConfig `yaml:"head"`
-	FullBody  RouteConfig `yaml:"full_body"`
-	FrontBody RouteConfig `yaml:"front_body"`
-	BackBody  RouteConfig `yaml:"back_body"`
-	LeftBody  RouteConfig `yaml:"left_body"`
-	RightBody RouteConfig `yaml:"right_body"`
-	RawSkin   RouteConfig `yaml:"raw_skin"`
+	Face       RouteConfig           `yaml:"face"`
+	Head       RouteConfig           `yaml:"head"`
+	FullBody   RouteConfig           `yaml:"full_body"`
+	FrontBody  RouteConfig           `yaml:"front_body"`
+	BackBody   RouteConfig           `yaml:"back_body"`
+	LeftBody   RouteConfig           `yaml:"left_body"`
+	RightBody  RouteConfig           `yaml:"right_body"`
+	Body3D     CameraRouteConfig     `yaml:"body_3d"`
+	Head3D     CameraRouteConfig     `yaml:"head_3d"`
+	Turntable  TurntableRouteConfig  `yaml:"turntable"`
+	RawSkin    RouteConfig           `yaml:"raw_skin"`
+	RawCape    RouteConfig           `yaml:"raw_cape"`
+	Batch      BatchRouteConfig      `yaml:"batch"`
+	Sheet      SheetRouteConfig      `yaml:"sheet"`
+	CustomSkin CustomSkinRouteConfig `yaml:"custom_skin"`
 }
 
 // RouteConfig is the configuration data used by a single API route.
@@ -124,15 +236,62 @@ type RouteConfig struct {
 	MaxScale        int    `yaml:"max_scale"`
 }
 
+// CameraRouteConfig is the configuration data used by an API route that renders the player model from any camera angle.
+type CameraRouteConfig struct {
+	RouteConfig  `yaml:",inline"`
+	DefaultYaw   int `yaml:"default_yaw"`
+	DefaultPitch int `yaml:"default_pitch"`
+}
+
+// TurntableRouteConfig is the configuration data used by an API route that renders the player model as an animation rotating
+// around the vertical axis. The delay is the amount of milliseconds each frame is displayed for.
+type TurntableRouteConfig struct {
+	CameraRouteConfig `yaml:",inline"`
+	DefaultFrames     int `yaml:"default_frames"`
+	MaxFrames         int `yaml:"max_frames"`
+	DefaultDelay      int `yaml:"default_delay"`
+	MinDelay          int `yaml:"min_delay"`
+	MaxDelay          int `yaml:"max_delay"`
+}
+
+// BatchRouteConfig is the configuration data used by the batch render route, which renders many players concurrently using
+// the options of the individual render routes.
+type BatchRouteConfig struct {
+	MaxPlayers int `yaml:"max_players"`
+	Workers    int `yaml:"workers"`
+}
+
+// SheetRouteConfig is the configuration data used by the sprite sheet routes, which render many players into a single image.
+// The players are rendered using the same number of workers as the batch route.
+type SheetRouteConfig struct {
+	RouteConfig    `yaml:",inline"`
+	MaxPlayers     int `yaml:"max_players"`
+	DefaultColumns int `yaml:"default_columns"`
+	MaxPadding     int `yaml:"max_padding"`
+}
+
+// CustomSkinRouteConfig is the configuration data used by the routes that render a skin which was uploaded or fetched from a
+// URL. Skins are only fetched from the allowed hosts, and the size is the maximum amount of bytes of the skin.
+type CustomSkinRouteConfig struct {
+	AllowedHosts []string `yaml:"allowed_hosts"`
+	MaxSize      int      `yaml:"max_size"`
+}
+
 // CacheConfig is the configuration data used to set TTL values for Redis keys.
 type CacheConfig struct {
-	Store               map[string]interface{} `yaml:"store"`
-	SkinCacheDuration   *time.Duration         `yaml:"skin_cache_duration"`
-	RenderCacheDuration *time.Duration         `yaml:"render_cache_duration"`
-	EnableLocks         bool                   `yaml:"enable_locks"`
+	Store                map[string]interface{} `yaml:"store"`
+	SkinCacheDuration    *time.Duration         `yaml:"skin_cache_duration"`
+	SkinStaleDuration    *time.Duration         `yaml:"skin_stale_duration"`
+	SkinFallbackDuration *time.Duration         `yaml:"skin_fallback_duration"`
+	RenderCacheDuration  *time.Duration         `yaml:"render_cache_duration"`
+	UUIDCacheDuration    *time.Duration         `yaml:"uuid_cache_duration"`
+	UnknownUUIDDuration  *time.Duration         `yaml:"unknown_uuid_duration"`
+	CacheControlMaxAge   *time.Duration         `yaml:"cache_control_max_age"`
+	EnableLocks          bool                   `yaml:"enable_locks"`
 }
 
-// ReadFile reads the configuration from the file and parses it as YAML.
+// ReadFile reads the configuration from the file and parses it as YAML on top of DefaultConfig, so that values missing from the
+// file use their default, such as the sections of routes that were added after the file was written.
 func (c *Config) ReadFile(file string) error {
 	data, err := os.ReadFile(file)
 
@@ -140,5 +299,24 @@ func (c *Config) ReadFile(file string) error {
 		return err
 	}
 
+	*c = *DefaultConfig
+
+	// Values behind pointers are copied, as parsing the file would otherwise change them within DefaultConfig
+	for _, duration := range []**time.Duration{
+		&c.Cache.SkinCacheDuration,
+		&c.Cache.SkinStaleDuration,
+		&c.Cache.SkinFallbackDuration,
+		&c.Cache.RenderCacheDuration,
+		&c.Cache.UUIDCacheDuration,
+		&c.Cache.UnknownUUIDDuration,
+		&c.Cache.CacheControlMaxAge,
+	} {
+		if *duration != nil {
+			*duration = PointerOf(**duration)
+		}
+	}
+
+	c.Routes.CustomSkin.AllowedHosts = append([]string{}, DefaultConfig.Routes.CustomSkin.AllowedHosts...)
+
 	return yaml.Unmarshal(data, c)
 }
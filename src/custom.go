@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	// ErrSkinTooLarge is returned when a custom skin is larger than the configured maximum size.
+	ErrSkinTooLarge error = errors.New("skin is too large")
+	// ErrSkinHostNotAllowed is returned when a skin URL, or any URL it redirects to, is not on one of the allowed hosts.
+	ErrSkinHostNotAllowed error = errors.New("skin URL host is not allowed")
+	// ErrSkinFetchFailed is returned when the request to a skin URL fails or does not respond with a skin.
+	ErrSkinFetchFailed error = errors.New("failed to fetch skin URL")
+	// customSkinClient is the HTTP client used to fetch skins by URL, which makes sure redirects stay on the allowed hosts.
+	customSkinClient *http.Client = &http.Client{
+		Timeout: time.Second * 10,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+
+			if !IsAllowedSkinURL(req.URL) {
+				return ErrSkinHostNotAllowed
+			}
+
+			return nil
+		},
+	}
+)
+
+// CustomSkinHandler is the API handler used for the `/render/:type` route, which renders a skin uploaded in the body of a POST
+// request or fetched from the `skin_url` query parameter of a GET request, instead of the skin of a player.
+func CustomSkinHandler(ctx *fiber.Ctx) error {
+	renderType, opts := ParseRenderTypeParams(ctx)
+
+	if opts == nil {
+		return nil
+	}
+
+	var (
+		err  error
+		data []byte
+	)
+
+	if ctx.Method() == fiber.MethodPost {
+		data, err = ReadUploadedSkin(ctx)
+	} else {
+		if len(ctx.Query("skin_url")) < 1 {
+			return ctx.Status(http.StatusBadRequest).SendString("Missing 'skin_url' query parameter")
+		}
+
+		data, err = FetchSkinURL(ctx.Query("skin_url"))
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSkinTooLarge):
+			return ctx.Status(http.StatusRequestEntityTooLarge).SendString(fmt.Sprintf("Skin is too large, the maximum is %d bytes", config.Routes.CustomSkin.MaxSize))
+		case errors.Is(err, ErrSkinHostNotAllowed):
+			return ctx.Status(http.StatusBadRequest).SendString("Invalid 'skin_url' query parameter, the host is not allowed")
+		case errors.Is(err, ErrSkinFetchFailed):
+			return ctx.Status(http.StatusBadGateway).SendString("Failed to fetch the skin from 'skin_url'")
+		case errors.Is(err, ErrInvalidSkin):
+			return ctx.Status(http.StatusBadRequest).SendString("Invalid skin, it must be a 64x64 or 64x32 PNG image, or an HD skin that is a multiple of either")
+		default:
+			return err
+		}
+	}
+
+	rawSkin, err := DecodeSkin(data)
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidSkin) {
+			return ctx.Status(http.StatusBadRequest).SendString("Invalid skin, it must be a 64x64 or 64x32 PNG image, or an HD skin that is a multiple of either")
+		}
+
+		return err
+	}
+
+	// Custom skins do not belong to a player, so the result is not cached and the player does not have a cape
+	result, err := RenderImage(renderType, rawSkin, ctx.QueryBool("slim", false), nil, opts)
+
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	if opts.Download {
+		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, renderType, opts.Format))
+	}
+
+	return ctx.Type(opts.Format).Send(result)
+}
+
+// ReadUploadedSkin returns the skin uploaded in the body of the request, either as the raw body or as the `skin` field of a
+// multipart form.
+func ReadUploadedSkin(ctx *fiber.Ctx) ([]byte, error) {
+	if !strings.HasPrefix(ctx.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if len(ctx.Body()) > config.Routes.CustomSkin.MaxSize {
+			return nil, ErrSkinTooLarge
+		}
+
+		return ctx.Body(), nil
+	}
+
+	header, err := ctx.FormFile("skin")
+
+	if err != nil {
+		return nil, ErrInvalidSkin
+	}
+
+	if header.Size > int64(config.Routes.CustomSkin.MaxSize) {
+		return nil, ErrSkinTooLarge
+	}
+
+	file, err := header.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// FetchSkinURL fetches the skin from the URL, which must use HTTP or HTTPS and point to one of the allowed hosts.
+func FetchSkinURL(value string) ([]byte, error) {
+	skinURL, err := url.Parse(value)
+
+	if err != nil || !IsAllowedSkinURL(skinURL) {
+		return nil, ErrSkinHostNotAllowed
+	}
+
+	resp, err := customSkinClient.Get(skinURL.String())
+
+	if err != nil {
+		// Redirects to hosts that are not allowed are reported as such, instead of as a failed request
+		if errors.Is(err, ErrSkinHostNotAllowed) {
+			return nil, ErrSkinHostNotAllowed
+		}
+
+		return nil, fmt.Errorf("%w: %v", ErrSkinFetchFailed, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected response: %s", ErrSkinFetchFailed, resp.Status)
+	}
+
+	// Read one byte more than the maximum so that skins which are too large can be told apart from ones that are exactly the limit
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(config.Routes.CustomSkin.MaxSize)+1))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSkinFetchFailed, err)
+	}
+
+	if len(data) > config.Routes.CustomSkin.MaxSize {
+		return nil, ErrSkinTooLarge
+	}
+
+	return data, nil
+}
+
+// IsAllowedSkinURL returns true if the URL uses HTTP or HTTPS and the host is one of the allowed hosts.
+func IsAllowedSkinURL(value *url.URL) bool {
+	if value.Scheme != "http" && value.Scheme != "https" {
+		return false
+	}
+
+	for _, host := range config.Routes.CustomSkin.AllowedHosts {
+		if strings.EqualFold(value.Hostname(), host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DecodeSkin decodes and normalizes the PNG image of a custom skin, returning ErrInvalidSkin if it is not a PNG image with the
+// dimensions of a skin. The dimensions are checked before the image is decoded.
+func DecodeSkin(data []byte) (*image.NRGBA, error) {
+	imageConfig, err := png.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil || !IsValidSkinSize(imageConfig.Width, imageConfig.Height) {
+		return nil, ErrInvalidSkin
+	}
+
+	rawSkin, err := DecodeImage(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrInvalidSkin
+	}
+
+	return NormalizeSkin(rawSkin)
+}
@@ -31,7 +31,7 @@ var (
 	instanceID uint16      = 0
 )
 
-func init() {
+func main() {
 	var err error
 
 	if err = config.ReadFile("config.yml"); err != nil {
@@ -44,33 +44,28 @@ func init() {
 
 	log.Println("Successfully connected to Redis")
 
-	storeType, ok := config.Cache.Store["type"].(string)
-
-	if !ok {
-		log.Fatalf("config: invalid cache.store.type type: %T", config.Cache.Store["type"])
-	}
-
-	s, ok = store.StoreTypes[storeType]
+	store.RedisURL = config.Redis
 
-	if !ok {
-		log.Fatalf("config: unknown store type: %s", storeType)
+	if s, err = store.New(config.Cache.Store); err != nil {
+		log.Fatal(err)
 	}
 
-	if err := s.Initialize(config.Cache.Store); err != nil {
+	if err = InitializeProviders(config.Providers); err != nil {
 		log.Fatal(err)
 	}
 
 	if instanceID, err = GetInstanceID(); err != nil {
 		log.Fatal(err)
 	}
-}
 
-func main() {
 	defer s.Close()
 
+	// The routes are registered once the configuration is loaded, as the middleware depends on the environment
+	registerRoutes()
+
 	log.Printf("Listening on %s:%d\n", config.Host, config.Port+instanceID)
 
-	if err := app.Listen(fmt.Sprintf("%s:%d", config.Host, config.Port+instanceID)); err != nil {
+	if err = app.Listen(fmt.Sprintf("%s:%d", config.Host, config.Port+instanceID)); err != nil {
 		panic(err)
 	}
 }
@@ -3,9 +3,27 @@ package main
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRateLimited is returned when the session server responds that too many requests have been made.
+	ErrRateLimited error = errors.New("mojang: rate limited")
+	// mojangClient is the HTTP client used for requests to the session server and API, so slow responses do not hang requests.
+	mojangClient *http.Client = &http.Client{Timeout: time.Second * 10}
+)
+
+const (
+	// DefaultSessionServer is the session server used to fetch player profiles when none is configured.
+	DefaultSessionServer = "https://sessionserver.mojang.com"
+	// DefaultMojangAPI is the API used to look up players by their username when none is configured.
+	DefaultMojangAPI = "https://api.mojang.com"
 )
 
 // MinecraftProfile is metadata about a Minecraft player returned from the Mojang API.
@@ -39,9 +57,9 @@ type DecodedTextures struct {
 	} `json:"textures"`
 }
 
-// GetMinecraftProfile returns the textures of a Minecraft player from Mojang.
-func GetMinecraftProfile(uuid string) (*MinecraftProfile, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://sessionserver.mojang.com/session/minecraft/profile/%s", uuid), nil)
+// GetMinecraftProfile returns the textures of a Minecraft player from the session server.
+func GetMinecraftProfile(sessionServer, uuid string) (*MinecraftProfile, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/session/minecraft/profile/%s", sessionServer, uuid), nil)
 
 	if err != nil {
 		return nil, err
@@ -49,22 +67,25 @@ func GetMinecraftProfile(uuid string) (*MinecraftProfile, error) {
 
 	req.Header.Set("User-Agent", "mineatar.io")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := mojangClient.Do(req)
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusNoContent {
+		switch resp.StatusCode {
+		case http.StatusNoContent:
 			return nil, nil
+		case http.StatusTooManyRequests:
+			return nil, ErrRateLimited
+		default:
+			return nil, fmt.Errorf("mojang: unexpected response: %s", resp.Status)
 		}
-
-		return nil, fmt.Errorf("mojang: unexpected response: %s", resp.Status)
 	}
 
-	defer resp.Body.Close()
-
 	body, err := io.ReadAll(resp.Body)
 
 	if err != nil {
@@ -80,6 +101,25 @@ func GetMinecraftProfile(uuid string) (*MinecraftProfile, error) {
 	return &response, nil
 }
 
+// GetTextures returns the decoded textures property of the Minecraft profile, or nil if the profile does not have one.
+func (p *MinecraftProfile) GetTextures() (*DecodedTextures, error) {
+	rawTextures := ""
+
+	for _, property := range p.Properties {
+		if property.Name != "textures" {
+			continue
+		}
+
+		rawTextures = property.Value
+	}
+
+	if len(rawTextures) < 1 {
+		return nil, nil
+	}
+
+	return DecodeTexturesValue(rawTextures)
+}
+
 // DecodeTexturesValue decodes the value from a MinecraftProfile texture property.
 func DecodeTexturesValue(value string) (*DecodedTextures, error) {
 	rawResult, err := base64.StdEncoding.DecodeString(value)
@@ -96,3 +136,73 @@ func DecodeTexturesValue(value string) (*DecodedTextures, error) {
 
 	return &result, nil
 }
+
+// GetUUIDFromUsername returns the UUID of a Minecraft player by their username from the API, or an empty string if the player does not exist.
+func GetUUIDFromUsername(api, username string) (string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/users/profiles/minecraft/%s", api, username), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("User-Agent", "mineatar.io")
+
+	resp, err := mojangClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("mojang: unexpected response: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		UUID     string `json:"id"`
+		Username string `json:"name"`
+	}
+
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+
+	return response.UUID, nil
+}
+
+// GetTextureURL returns the URL of a texture from a profile, pointing it at the texture host if there is one. The path of the
+// texture is kept, and appended to the path of the texture host.
+func GetTextureURL(textureHost, value string) (string, error) {
+	if len(textureHost) < 1 {
+		return value, nil
+	}
+
+	textureURL, err := url.Parse(value)
+
+	if err != nil {
+		return "", err
+	}
+
+	hostURL, err := url.Parse(textureHost)
+
+	if err != nil {
+		return "", err
+	}
+
+	textureURL.Scheme = hostURL.Scheme
+	textureURL.Host = hostURL.Host
+	textureURL.Path = strings.TrimSuffix(hostURL.Path, "/") + textureURL.Path
+
+	return textureURL.String(), nil
+}
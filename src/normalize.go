@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"image"
+)
+
+const (
+	// maxSkinWidth is the width of the largest HD skin that is accepted.
+	maxSkinWidth = 1024
+)
+
+var (
+	// ErrInvalidSkin is returned when a skin does not have the dimensions of a modern, legacy or HD skin.
+	ErrInvalidSkin error = errors.New("invalid skin")
+	// legacyLimbCopies is the list of areas copied from the right limbs of a legacy skin to the left limbs, where each area is
+	// mirrored horizontally. The values are the source position, the offset to the destination and the size of the area, the
+	// same as the vanilla client.
+	legacyLimbCopies [][6]int = [][6]int{
+		{4, 16, 16, 32, 4, 4},
+		{8, 16, 16, 32, 4, 4},
+		{0, 20, 24, 32, 4, 12},
+		{4, 20, 16, 32, 4, 12},
+		{8, 20, 8, 32, 4, 12},
+		{12, 20, 16, 32, 4, 12},
+		{44, 16, -8, 32, 4, 4},
+		{48, 16, -8, 32, 4, 4},
+		{40, 20, 0, 32, 4, 12},
+		{44, 20, -8, 32, 4, 12},
+		{48, 20, -16, 32, 4, 12},
+		{52, 20, -8, 32, 4, 12},
+	}
+	// baseLayerAreas is the list of areas of the skin that belong to the base layer, which are always opaque.
+	baseLayerAreas []image.Rectangle = []image.Rectangle{
+		image.Rect(0, 0, 32, 16),
+		image.Rect(0, 16, 64, 32),
+		image.Rect(16, 48, 48, 64),
+	}
+)
+
+// IsValidSkinSize returns true if the dimensions are those of a modern 64x64 skin or a legacy 64x32 skin, or an HD skin that is
+// a multiple of either.
+func IsValidSkinSize(width, height int) bool {
+	if width < 64 || width > maxSkinWidth || width%64 != 0 {
+		return false
+	}
+
+	return height == width || height == width/2
+}
+
+// NormalizeSkin returns the skin as a 64x64 skin in the same way as the vanilla client, returning ErrInvalidSkin if the skin
+// does not have a valid size. HD skins are scaled down, legacy 64x32 skins are upgraded by mirroring the right limbs onto the
+// left limbs, and the base layer is made opaque.
+func NormalizeSkin(img *image.NRGBA) (*image.NRGBA, error) {
+	bounds := img.Bounds()
+
+	if !IsValidSkinSize(bounds.Dx(), bounds.Dy()) {
+		return nil, ErrInvalidSkin
+	}
+
+	var (
+		scale  int          = bounds.Dx() / 64
+		legacy bool         = bounds.Dy() == bounds.Dx()/2
+		result *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	)
+
+	// Scale HD skins down using the top-left pixel of each block, which is exact for skins that were scaled up from 64x64
+	for y := 0; y < bounds.Dy()/scale; y++ {
+		for x := 0; x < 64; x++ {
+			result.SetNRGBA(x, y, img.NRGBAAt(bounds.Min.X+x*scale, bounds.Min.Y+y*scale))
+		}
+	}
+
+	if legacy {
+		for _, area := range legacyLimbCopies {
+			copyMirroredArea(result, area[0], area[1], area[2], area[3], area[4], area[5])
+		}
+
+		// Legacy skins commonly used a solid color for the unused hat layer, which is hidden if it is fully opaque
+		clearOpaqueArea(result, image.Rect(32, 0, 64, 32))
+	}
+
+	for _, area := range baseLayerAreas {
+		setOpaque(result, area)
+	}
+
+	return result, nil
+}
+
+// copyMirroredArea copies the area of the skin at the position to the offset position, mirrored horizontally.
+func copyMirroredArea(img *image.NRGBA, x, y, offsetX, offsetY, width, height int) {
+	for dy := 0; dy < height; dy++ {
+		for dx := 0; dx < width; dx++ {
+			img.SetNRGBA(x+offsetX+width-dx-1, y+offsetY+dy, img.NRGBAAt(x+dx, y+dy))
+		}
+	}
+}
+
+// clearOpaqueArea makes the area of the skin fully transparent if every pixel is mostly opaque, and otherwise leaves it as-is.
+// Only the alpha is cleared, the same as the vanilla client, so the parts of the area that belong to the base layer keep their
+// color when they are made opaque again.
+func clearOpaqueArea(img *image.NRGBA, area image.Rectangle) {
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if img.NRGBAAt(x, y).A < 128 {
+				return
+			}
+		}
+	}
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			img.Pix[img.PixOffset(x, y)+3] = 0
+		}
+	}
+}
+
+// setOpaque sets the alpha of every pixel within the area of the skin to fully opaque, keeping the color.
+func setOpaque(img *image.NRGBA, area image.Rectangle) {
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			img.Pix[img.PixOffset(x, y)+3] = 255
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testSkin returns a skin of the size filled with the color, with each of the pixels set to their own color.
+func testSkin(width, height int, fill color.NRGBA, pixels map[image.Point]color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, fill)
+		}
+	}
+
+	for point, c := range pixels {
+		img.SetNRGBA(point.X, point.Y, c)
+	}
+
+	return img
+}
+
+func TestNormalizeSkinInvalidSize(t *testing.T) {
+	sizes := [][2]int{{32, 32}, {64, 48}, {64, 16}, {100, 100}, {2048, 2048}}
+
+	for _, size := range sizes {
+		if _, err := NormalizeSkin(image.NewNRGBA(image.Rect(0, 0, size[0], size[1]))); !errors.Is(err, ErrInvalidSkin) {
+			t.Fatalf("%dx%d: expected ErrInvalidSkin, got %v", size[0], size[1], err)
+		}
+	}
+}
+
+func TestNormalizeSkin(t *testing.T) {
+	var (
+		red         color.NRGBA = color.NRGBA{255, 0, 0, 255}
+		green       color.NRGBA = color.NRGBA{0, 255, 0, 255}
+		transparent color.NRGBA = color.NRGBA{}
+		hidden      color.NRGBA = color.NRGBA{0, 0, 255, 0}
+	)
+
+	tests := []struct {
+		name     string
+		skin     *image.NRGBA
+		expected map[image.Point]color.NRGBA
+	}{
+		{
+			// The top of the right leg is mirrored onto the top of the left leg
+			name:     "legacy limb copy",
+			skin:     testSkin(64, 32, green, map[image.Point]color.NRGBA{{4, 16}: red}),
+			expected: map[image.Point]color.NRGBA{{23, 48}: red, {20, 48}: green},
+		},
+		{
+			// A legacy hat layer that is completely opaque is hidden the same as the vanilla client, which keeps the color of the
+			// arms and body within the same area
+			name:     "legacy opaque hat layer",
+			skin:     testSkin(64, 32, green, nil),
+			expected: map[image.Point]color.NRGBA{{32, 0}: {0, 255, 0, 0}, {63, 15}: {0, 255, 0, 0}, {44, 20}: green, {31, 15}: green},
+		},
+		{
+			name:     "legacy transparent hat layer",
+			skin:     testSkin(64, 32, green, map[image.Point]color.NRGBA{{40, 8}: transparent}),
+			expected: map[image.Point]color.NRGBA{{40, 8}: transparent, {41, 8}: green},
+		},
+		{
+			// The base layer is always opaque while keeping its color, and the overlay keeps its transparency
+			name:     "opaque base layer",
+			skin:     testSkin(64, 64, transparent, map[image.Point]color.NRGBA{{8, 8}: hidden, {20, 20}: hidden}),
+			expected: map[image.Point]color.NRGBA{{8, 8}: {0, 0, 255, 255}, {20, 20}: {0, 0, 255, 255}, {40, 8}: transparent, {20, 36}: transparent},
+		},
+		{
+			// HD skins use the top-left pixel of each block
+			name:     "HD downscale",
+			skin:     testSkin(128, 128, green, map[image.Point]color.NRGBA{{16, 16}: red, {18, 16}: red, {21, 17}: red}),
+			expected: map[image.Point]color.NRGBA{{8, 8}: red, {9, 8}: red, {10, 8}: green},
+		},
+		{
+			name:     "legacy HD downscale",
+			skin:     testSkin(128, 64, green, map[image.Point]color.NRGBA{{8, 32}: red}),
+			expected: map[image.Point]color.NRGBA{{4, 16}: red, {23, 48}: red},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := NormalizeSkin(test.skin)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if result.Bounds() != image.Rect(0, 0, 64, 64) {
+			t.Fatalf("%s: result bounds %v", test.name, result.Bounds())
+		}
+
+		for point, expected := range test.expected {
+			if actual := result.NRGBAAt(point.X, point.Y); actual != expected {
+				t.Fatalf("%s: pixel %v is %v, expected %v", test.name, point, actual, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mineatar-io/skin-render"
+)
+
+var (
+	// ProviderTypes is the list of skin provider types that can be configured, by the `type` configuration value.
+	ProviderTypes map[string]func() SkinProvider = map[string]func() SkinProvider{
+		"mojang":   func() SkinProvider { return &MojangProvider{} },
+		"template": func() SkinProvider { return &TemplateProvider{} },
+	}
+	// skinProviders is the configured skin providers by their name.
+	skinProviders map[string]SkinProvider = make(map[string]SkinProvider)
+	// providerPriority is the names of the configured skin providers in the order they are tried when a request does not
+	// specify a provider.
+	providerPriority []string = make([]string, 0)
+)
+
+// SkinProvider is a source of the skins and capes of players, such as Mojang or the skin system of an offline mode server.
+type SkinProvider interface {
+	Initialize(providerConfig map[string]interface{}) error
+	// LookupUUID returns the UUID of the player by their username, or an empty string if the player does not exist.
+	LookupUUID(username string) (string, error)
+	// GetTextures returns the textures of the player by their UUID, or nil if the player does not exist.
+	GetTextures(uuid string) (*PlayerTextures, error)
+}
+
+// PlayerTextures is the location of the textures of a player returned by a skin provider, where an empty URL means the player
+// does not have that texture. The skin hash is the texture hash of the skin if the provider knows it, which is otherwise
+// computed from the skin itself.
+type PlayerTextures struct {
+	SkinURL  string
+	SkinHash string
+	CapeURL  string
+	Slim     bool
+}
+
+// InitializeProviders creates the skin providers from the configuration, in order of priority. If no providers are configured,
+// a single Mojang provider is created using the `mojang` configuration.
+func InitializeProviders(configs []map[string]interface{}) error {
+	if len(configs) < 1 {
+		configs = []map[string]interface{}{
+			{
+				"name":           "mojang",
+				"type":           "mojang",
+				"session_server": config.Mojang.SessionServer,
+				"api":            config.Mojang.API,
+				"texture_host":   config.Mojang.TextureHost,
+			},
+		}
+	}
+
+	for i, providerConfig := range configs {
+		name, ok := providerConfig["name"].(string)
+
+		if !ok || len(name) < 1 {
+			return fmt.Errorf("provider: invalid name value of provider #%d: %v", i+1, providerConfig["name"])
+		}
+
+		if _, ok = skinProviders[name]; ok {
+			return fmt.Errorf("provider: duplicate provider name: %s", name)
+		}
+
+		providerType, ok := providerConfig["type"].(string)
+
+		if !ok {
+			return fmt.Errorf("provider: invalid type value of provider %s: %v", name, providerConfig["type"])
+		}
+
+		newProvider, ok := ProviderTypes[providerType]
+
+		if !ok {
+			return fmt.Errorf("provider: unknown provider type: %s", providerType)
+		}
+
+		provider := newProvider()
+
+		if err := provider.Initialize(providerConfig); err != nil {
+			return err
+		}
+
+		skinProviders[name] = provider
+		providerPriority = append(providerPriority, name)
+	}
+
+	return nil
+}
+
+// GetPlayerCacheID returns the value used in place of the UUID of the player in cache keys, which is only the UUID when the
+// provider is selected by priority so that each explicitly requested provider is cached separately.
+func GetPlayerCacheID(uuid, provider string) string {
+	if len(provider) < 1 {
+		return uuid
+	}
+
+	return fmt.Sprintf("%s:%s", provider, uuid)
+}
+
+// GetPlayerTextures returns the textures of the player from the provider, or from the first provider by priority that has a
+// skin for the player if the provider is empty. Errors from providers are skipped over while falling back, and are only
+// returned if no provider has the player.
+func GetPlayerTextures(uuid, provider string) (*PlayerTextures, error) {
+	if len(provider) > 0 {
+		return skinProviders[provider].GetTextures(uuid)
+	}
+
+	var (
+		result  *PlayerTextures = nil
+		lastErr error           = nil
+	)
+
+	for _, name := range providerPriority {
+		textures, err := skinProviders[name].GetTextures(uuid)
+
+		if err != nil {
+			// Throttled requests are already logged by the rate limiter, and are expected while the rate limit is reached
+			if !errors.Is(err, ErrThrottled) {
+				log.Printf("Error: failed to get textures of %s from provider %s: %v\n", uuid, name, err)
+			}
+
+			lastErr = err
+
+			continue
+		}
+
+		if textures == nil {
+			continue
+		}
+
+		if len(textures.SkinURL) > 0 {
+			return textures, nil
+		}
+
+		// Players without a skin are only used if no other provider has a skin for them
+		if result == nil {
+			result = textures
+		}
+	}
+
+	if result != nil {
+		return result, nil
+	}
+
+	return nil, lastErr
+}
+
+// MojangProvider is a skin provider using the Mojang API, or any other server implementing the same API such as Ely.by or an
+// authlib-injector server. Values that are not configured default to the servers of Mojang. Requests to the session server are
+// rate limited using the `mojang` configuration.
+type MojangProvider struct {
+	limiter       *RateLimiter
+	SessionServer string
+	API           string
+	TextureHost   string
+}
+
+func (p *MojangProvider) Initialize(providerConfig map[string]interface{}) error {
+	p.SessionServer = DefaultSessionServer
+	p.API = DefaultMojangAPI
+
+	values := []struct {
+		Key   string
+		Value *string
+	}{
+		{"session_server", &p.SessionServer},
+		{"api", &p.API},
+		{"texture_host", &p.TextureHost},
+	}
+
+	for _, value := range values {
+		raw, ok := providerConfig[value.Key]
+
+		if !ok || raw == nil {
+			continue
+		}
+
+		str, ok := raw.(string)
+
+		if !ok {
+			return fmt.Errorf("provider: invalid %s value: %v", value.Key, raw)
+		}
+
+		if len(str) > 0 {
+			*value.Value = strings.TrimSuffix(str, "/")
+		}
+	}
+
+	p.limiter = NewRateLimiter(fmt.Sprintf("ratelimit:%s", p.SessionServer), config.Mojang.RateLimit)
+
+	return nil
+}
+
+func (p *MojangProvider) LookupUUID(username string) (string, error) {
+	return GetUUIDFromUsername(p.API, username)
+}
+
+func (p *MojangProvider) GetTextures(uuid string) (*PlayerTextures, error) {
+	if err := p.limiter.Wait(); err != nil {
+		return nil, err
+	}
+
+	profile, err := GetMinecraftProfile(p.SessionServer, uuid)
+
+	if err != nil || profile == nil {
+		return nil, err
+	}
+
+	if err = r.Set(fmt.Sprintf("unique:%s", profile.UUID), "0", 0); err != nil {
+		return nil, err
+	}
+
+	textures, err := profile.GetTextures()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PlayerTextures{}
+
+	if textures == nil {
+		return result, nil
+	}
+
+	result.Slim = textures.Textures.Skin.Metadata.Model == "slim"
+
+	if len(textures.Textures.Skin.URL) > 0 {
+		if result.SkinURL, err = GetTextureURL(p.TextureHost, textures.Textures.Skin.URL); err != nil {
+			return nil, err
+		}
+
+		result.SkinHash = GetTextureHash(textures.Textures.Skin.URL)
+	}
+
+	if len(textures.Textures.Cape.URL) > 0 {
+		if result.CapeURL, err = GetTextureURL(p.TextureHost, textures.Textures.Cape.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+var _ SkinProvider = &MojangProvider{}
+
+// TemplateProvider is a skin provider that fetches textures directly from URLs containing the UUID of the player, such as the
+// skin system of an offline mode server. The `{uuid}` placeholder is replaced with the UUID of the player without dashes, and
+// usernames are resolved to their offline mode UUID. The model is either `slim`, `classic`, or empty to use the default model
+// of the UUID.
+type TemplateProvider struct {
+	client  *http.Client
+	SkinURL string
+	CapeURL string
+	Model   string
+}
+
+func (p *TemplateProvider) Initialize(providerConfig map[string]interface{}) error {
+	skinURL, ok := providerConfig["skin_url"].(string)
+
+	if !ok || !strings.Contains(skinURL, "{uuid}") {
+		return fmt.Errorf("provider: invalid skin URL value, it must contain {uuid}: %v", providerConfig["skin_url"])
+	}
+
+	p.SkinURL = skinURL
+
+	if value, ok := providerConfig["cape_url"]; ok && value != nil {
+		if p.CapeURL, ok = value.(string); !ok {
+			return fmt.Errorf("provider: invalid cape URL value: %v", value)
+		}
+	}
+
+	if value, ok := providerConfig["model"]; ok && value != nil {
+		if p.Model, ok = value.(string); !ok || (p.Model != "slim" && p.Model != "classic" && len(p.Model) > 0) {
+			return fmt.Errorf("provider: invalid model value: %v", value)
+		}
+	}
+
+	p.client = &http.Client{Timeout: time.Second * 10}
+
+	return nil
+}
+
+func (p *TemplateProvider) LookupUUID(username string) (string, error) {
+	return GetOfflineUUID(username), nil
+}
+
+func (p *TemplateProvider) GetTextures(uuid string) (*PlayerTextures, error) {
+	skinURL, err := p.findTexture(p.SkinURL, uuid)
+
+	if err != nil || len(skinURL) < 1 {
+		return nil, err
+	}
+
+	result := &PlayerTextures{
+		SkinURL: skinURL,
+		Slim:    p.Model == "slim",
+	}
+
+	if len(p.Model) < 1 {
+		result.Slim = skin.IsSlimFromUUID(uuid)
+	}
+
+	if len(p.CapeURL) > 0 {
+		if result.CapeURL, err = p.findTexture(p.CapeURL, uuid); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// findTexture returns the URL of the texture from the template, or an empty string if the texture does not exist.
+func (p *TemplateProvider) findTexture(template, uuid string) (string, error) {
+	textureURL := strings.ReplaceAll(template, "{uuid}", uuid)
+
+	resp, err := p.client.Head(textureURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent:
+		return "", nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return textureURL, nil
+	default:
+		return "", fmt.Errorf("provider: unexpected response: %s", resp.Status)
+	}
+}
+
+var _ SkinProvider = &TemplateProvider{}
+
+// GetOfflineUUID returns the UUID that an offline mode server assigns to a player by their username, which is the version 3
+// UUID of "OfflinePlayer:<username>".
+func GetOfflineUUID(username string) string {
+	hash := md5.Sum([]byte("OfflinePlayer:" + username))
+
+	hash[6] = hash[6]&0x0f | 0x30
+	hash[8] = hash[8]&0x3f | 0x80
+
+	return hex.EncodeToString(hash[:])
+}
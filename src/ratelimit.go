@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrThrottled is returned when a request to an upstream server could not be made in time because of the rate limit.
+	ErrThrottled error = errors.New("ratelimit: throttled")
+)
+
+// RateLimiter is a token bucket limiting the requests made to an upstream server, which is stored in Redis so that the limit is
+// shared by every process. Requests reserve the next token when it is available within the timeout and wait for it, so they are
+// served in the order they arrived across every process, and only a bounded amount of requests in this process wait at the same
+// time.
+type RateLimiter struct {
+	Key       string
+	Rate      float64
+	Burst     int
+	Timeout   time.Duration
+	queue     chan struct{}
+	mutex     sync.Mutex
+	throttled int
+	loggedAt  time.Time
+}
+
+// NewRateLimiter creates a rate limiter using the configuration, or returns nil if the rate limit is disabled.
+func NewRateLimiter(key string, config RateLimitConfig) *RateLimiter {
+	if config.Requests < 1 || config.Interval < time.Millisecond {
+		return nil
+	}
+
+	limiter := &RateLimiter{
+		Key:     key,
+		Rate:    float64(config.Requests) / float64(config.Interval.Milliseconds()),
+		Burst:   config.Burst,
+		Timeout: config.Timeout,
+		queue:   make(chan struct{}, config.MaxQueue),
+	}
+
+	if limiter.Burst < 1 {
+		limiter.Burst = config.Requests
+	}
+
+	return limiter
+}
+
+// Wait blocks until a request can be made within the rate limit, returning ErrThrottled if that is not possible before the
+// timeout or the queue of waiting requests is full. A nil rate limiter never waits.
+func (l *RateLimiter) Wait() error {
+	if l == nil {
+		return nil
+	}
+
+	// Requests that cannot join the queue may still take a token that is available right away, but never reserve one
+	maxWait := time.Duration(0)
+
+	select {
+	case l.queue <- struct{}{}:
+		{
+			maxWait = l.Timeout
+
+			defer func() { <-l.queue }()
+
+			break
+		}
+	default:
+		break
+	}
+
+	wait, err := r.TakeToken(l.Key, l.Rate, l.Burst, maxWait)
+
+	if err != nil {
+		return err
+	}
+
+	if wait > maxWait {
+		return l.onThrottled()
+	}
+
+	time.Sleep(wait)
+
+	return nil
+}
+
+// onThrottled counts the throttled request and returns ErrThrottled. The count is logged at most once per minute, so that a burst
+// of throttled requests does not flood the log.
+func (l *RateLimiter) onThrottled() error {
+	l.mutex.Lock()
+
+	defer l.mutex.Unlock()
+
+	l.throttled++
+
+	if time.Since(l.loggedAt) >= time.Minute {
+		log.Printf("Warning: %d request(s) throttled by the rate limit of %s since the last warning\n", l.throttled, l.Key)
+
+		l.throttled = 0
+		l.loggedAt = time.Now()
+	}
+
+	return ErrThrottled
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"image"
 	"image/draw"
 	"time"
@@ -15,6 +16,37 @@ import (
 
 const defaultTimeout = 5 * time.Second
 
+// tokenBucketScript takes a token from the bucket at the key and returns the milliseconds until it may be used. Tokens that are
+// not available yet are reserved if the wait is within the maximum, leaving the bucket in debt so that requests are served in
+// the order they reserved their token. The bucket expires once it would have been refilled completely, as it is then the same as
+// a new bucket.
+var tokenBucketScript *redis.Script = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local max_wait = tonumber(ARGV[3])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+local wait = 0
+
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+
+if tokens < 1 then
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+if wait <= max_wait then
+	tokens = tokens - 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+
+return wait
+`)
+
 // Redis is a utility client for reading and writing values to the Redis server.
 type Redis struct {
 	Client     *redis.Client
@@ -145,6 +177,24 @@ func (r *Redis) NewMutex(name string) *Mutex {
 	}
 }
 
+// TakeToken takes a token from the token bucket of the key, which is refilled at the rate in tokens per millisecond up to the
+// burst. It returns how long until the token may be used, which is zero if one was available. If no token is available, the next
+// one is reserved when it is available within the maximum wait, and otherwise nothing is taken and the returned wait is longer
+// than the maximum. The time of the Redis server is used so that the bucket does not depend on the clocks of each process.
+func (r *Redis) TakeToken(key string, rate float64, burst int, maxWait time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+	defer cancel()
+
+	wait, err := tokenBucketScript.Run(ctx, r.Client, []string{key}, rate, burst, maxWait.Milliseconds()).Int64()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
 // Close closes the connection to the database.
 func (r *Redis) Close() error {
 	return r.Client.Close()
@@ -168,6 +218,27 @@ func (m *Mutex) Lock() error {
 	return m.Mutex.LockContext(ctx)
 }
 
+// TryLock will attempt to lock the mutex once without waiting, returning false if another process already holds it.
+func (m *Mutex) TryLock() (bool, error) {
+	if m.Mutex == nil {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+	defer cancel()
+
+	if err := m.Mutex.TryLockContext(ctx); err != nil {
+		if errors.Is(err, redsync.ErrFailed) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
 // Unlock will allow any other process to obtain a lock with the same key.
 func (m *Mutex) Unlock() error {
 	if m.Mutex == nil {
@@ -0,0 +1,50 @@
+package render
+
+import "image"
+
+// SetCape attaches a cape textured using the cape image to the back of the player model in place of any elytra, or removes
+// it if the image is nil.
+func (m *PlayerModel) SetCape(cape *image.NRGBA) {
+	m.removeAttachments()
+
+	if cape == nil {
+		return
+	}
+
+	// The cape hangs slightly away from the back of the player, and is turned around so the front of its texture faces
+	// backwards like in Minecraft
+	m.Cape = &Part{
+		Pivot:    Vec3{0, 24, -2},
+		Rotation: Vec3{6, 0, 0},
+		Children: []*Part{
+			{
+				Texture:      cape,
+				TextureWidth: 64,
+				Pivot:        Vec3{0, 24, -2.5},
+				Rotation:     Vec3{0, 180, 0},
+				Boxes: []Box{
+					NewBox(-5, 8, -3, 10, 16, 1, 0, 0, 0),
+				},
+			},
+		},
+	}
+
+	m.Body.Children = append(m.Body.Children, m.Cape)
+}
+
+// removeAttachments removes the cape and elytra from the player model, since only one of them can be worn at a time.
+func (m *PlayerModel) removeAttachments() {
+	children := make([]*Part, 0, len(m.Body.Children))
+
+	for _, child := range m.Body.Children {
+		if child == m.Cape || child == m.Elytra {
+			continue
+		}
+
+		children = append(children, child)
+	}
+
+	m.Body.Children = children
+	m.Cape = nil
+	m.Elytra = nil
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"bytes"
+	// Used to embed the default elytra texture as a variable
+	_ "embed"
+	"image"
+	"image/draw"
+	"image/png"
+)
+
+var (
+	//go:embed elytra.png
+	rawElytraTextureData []byte
+	defaultElytraTexture *image.NRGBA = nil
+)
+
+func init() {
+	rawElytraTexture, err := png.Decode(bytes.NewReader(rawElytraTextureData))
+
+	if err != nil {
+		panic(err)
+	}
+
+	defaultElytraTexture = image.NewNRGBA(rawElytraTexture.Bounds())
+	draw.Draw(defaultElytraTexture, rawElytraTexture.Bounds(), rawElytraTexture, image.Pt(0, 0), draw.Src)
+}
+
+// SetElytra attaches an elytra to the back of the player model in place of the cape, textured using the elytra part of a cape
+// texture. The default elytra texture is used if the texture is nil or does not contain an elytra, like legacy capes.
+func (m *PlayerModel) SetElytra(texture *image.NRGBA, spread bool) {
+	m.removeAttachments()
+
+	if texture == nil || texture.Bounds().Dx() < 64 {
+		texture = defaultElytraTexture
+	}
+
+	var (
+		pitch float64 = 15
+		roll  float64 = 15
+	)
+
+	// Spread wings are the same as when the player is flying with the elytra
+	if spread {
+		pitch = 20
+		roll = 90
+	}
+
+	m.Elytra = &Part{
+		Children: []*Part{
+			{
+				Texture:      texture,
+				TextureWidth: 64,
+				Pivot:        Vec3{5, 24, -2},
+				Rotation:     Vec3{pitch, 0, roll},
+				Boxes: []Box{
+					NewBox(-5, 4, -4, 10, 20, 2, 22, 0, 1),
+				},
+			},
+			{
+				Texture:      texture,
+				TextureWidth: 64,
+				Pivot:        Vec3{-5, 24, -2},
+				Rotation:     Vec3{pitch, 0, -roll},
+				Boxes: []Box{
+					mirroredBox(NewBox(-5, 4, -4, 10, 20, 2, 22, 0, 1)),
+				},
+			},
+		},
+	}
+
+	m.Body.Children = append(m.Body.Children, m.Elytra)
+}
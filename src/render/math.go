@@ -0,0 +1,112 @@
+package render
+
+import "math"
+
+// Vec3 is a point or direction in model space, where X points to the left of the player, Y points up and Z points out of the
+// front of the player.
+type Vec3 struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+// Add returns the sum of both vectors.
+func (a Vec3) Add(b Vec3) Vec3 {
+	return Vec3{a.X + b.X, a.Y + b.Y, a.Z + b.Z}
+}
+
+// Sub returns the difference of both vectors.
+func (a Vec3) Sub(b Vec3) Vec3 {
+	return Vec3{a.X - b.X, a.Y - b.Y, a.Z - b.Z}
+}
+
+// Scale returns the vector multiplied by the factor.
+func (a Vec3) Scale(factor float64) Vec3 {
+	return Vec3{a.X * factor, a.Y * factor, a.Z * factor}
+}
+
+// Mat3 is a 3x3 matrix in row-major order, used for rotations.
+type Mat3 [9]float64
+
+// Identity is the identity matrix that leaves vectors unchanged.
+var Identity Mat3 = Mat3{
+	1, 0, 0,
+	0, 1, 0,
+	0, 0, 1,
+}
+
+// Multiply returns the product of both matrices, which applies b before a.
+func (a Mat3) Multiply(b Mat3) Mat3 {
+	var result Mat3
+
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			result[row*3+col] = a[row*3]*b[col] + a[row*3+1]*b[3+col] + a[row*3+2]*b[6+col]
+		}
+	}
+
+	return result
+}
+
+// Apply returns the vector transformed by the matrix.
+func (a Mat3) Apply(v Vec3) Vec3 {
+	return Vec3{
+		a[0]*v.X + a[1]*v.Y + a[2]*v.Z,
+		a[3]*v.X + a[4]*v.Y + a[5]*v.Z,
+		a[6]*v.X + a[7]*v.Y + a[8]*v.Z,
+	}
+}
+
+// RotationX returns a matrix rotating around the X axis by the angle in degrees, where positive values tilt the top of a part forwards.
+func RotationX(degrees float64) Mat3 {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+
+	return Mat3{
+		1, 0, 0,
+		0, cos, -sin,
+		0, sin, cos,
+	}
+}
+
+// RotationY returns a matrix rotating around the Y axis by the angle in degrees, where positive values turn the front of a part
+// towards its left side.
+func RotationY(degrees float64) Mat3 {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+
+	return Mat3{
+		cos, 0, sin,
+		0, 1, 0,
+		-sin, 0, cos,
+	}
+}
+
+// RotationZ returns a matrix rotating around the Z axis by the angle in degrees, where positive values roll the top of a part
+// towards its right side.
+func RotationZ(degrees float64) Mat3 {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+
+	return Mat3{
+		cos, -sin, 0,
+		sin, cos, 0,
+		0, 0, 1,
+	}
+}
+
+// Transform is an affine transformation made of a rotation followed by a translation.
+type Transform struct {
+	Rotation    Mat3
+	Translation Vec3
+}
+
+// Apply returns the point transformed by the transformation.
+func (t Transform) Apply(v Vec3) Vec3 {
+	return t.Rotation.Apply(v).Add(t.Translation)
+}
+
+// Then returns the transformation that applies t first and then b.
+func (t Transform) Then(b Transform) Transform {
+	return Transform{
+		Rotation:    b.Rotation.Multiply(t.Rotation),
+		Translation: b.Apply(t.Translation),
+	}
+}
@@ -0,0 +1,112 @@
+package render
+
+import "image"
+
+// PlayerModel is the model of a Minecraft player, made of parts that can be rotated individually.
+type PlayerModel struct {
+	Head     *Part
+	Body     *Part
+	RightArm *Part
+	LeftArm  *Part
+	RightLeg *Part
+	LeftLeg  *Part
+	Cape     *Part
+	Elytra   *Part
+}
+
+// NewPlayerModel returns the model of a player standing upright, textured using the skin. Legacy 64x32 skins use mirrored
+// textures of the right arm and leg for the left arm and leg, the same way the Minecraft client does.
+func NewPlayerModel(skin *image.NRGBA, slim, overlay bool) *PlayerModel {
+	var (
+		isLegacy bool = skin.Bounds().Dx() == skin.Bounds().Dy()*2
+		armWidth int  = 4
+	)
+
+	if slim {
+		armWidth = 3
+	}
+
+	model := &PlayerModel{
+		Head: &Part{
+			Pivot: Vec3{0, 24, 0},
+			Boxes: []Box{
+				opaqueBox(NewBox(-4, 24, -4, 8, 8, 8, 0, 0, 0)),
+			},
+		},
+		Body: &Part{
+			Pivot: Vec3{0, 24, 0},
+			Boxes: []Box{
+				opaqueBox(NewBox(-4, 12, -2, 8, 12, 4, 16, 16, 0)),
+			},
+		},
+		RightArm: &Part{
+			Pivot: Vec3{-5, 22, 0},
+			Boxes: []Box{
+				opaqueBox(NewBox(float64(-4-armWidth), 12, -2, armWidth, 12, 4, 40, 16, 0)),
+			},
+		},
+		LeftArm: &Part{
+			Pivot: Vec3{5, 22, 0},
+		},
+		RightLeg: &Part{
+			Pivot: Vec3{-2, 12, 0},
+			Boxes: []Box{
+				opaqueBox(NewBox(-4, 0, -2, 4, 12, 4, 0, 16, 0)),
+			},
+		},
+		LeftLeg: &Part{
+			Pivot: Vec3{2, 12, 0},
+		},
+	}
+
+	if isLegacy {
+		model.LeftArm.Boxes = []Box{mirroredBox(opaqueBox(NewBox(4, 12, -2, armWidth, 12, 4, 40, 16, 0)))}
+		model.LeftLeg.Boxes = []Box{mirroredBox(opaqueBox(NewBox(0, 0, -2, 4, 12, 4, 0, 16, 0)))}
+	} else {
+		model.LeftArm.Boxes = []Box{opaqueBox(NewBox(4, 12, -2, armWidth, 12, 4, 32, 48, 0))}
+		model.LeftLeg.Boxes = []Box{opaqueBox(NewBox(0, 0, -2, 4, 12, 4, 16, 48, 0))}
+	}
+
+	if overlay {
+		model.Head.Boxes = append(model.Head.Boxes, overlayBox(NewBox(-4, 24, -4, 8, 8, 8, 32, 0, 0.5)))
+
+		// Legacy skins do not have an overlay layer for anything other than the head
+		if !isLegacy {
+			model.Body.Boxes = append(model.Body.Boxes, overlayBox(NewBox(-4, 12, -2, 8, 12, 4, 16, 32, 0.25)))
+			model.RightArm.Boxes = append(model.RightArm.Boxes, overlayBox(NewBox(float64(-4-armWidth), 12, -2, armWidth, 12, 4, 40, 32, 0.25)))
+			model.LeftArm.Boxes = append(model.LeftArm.Boxes, overlayBox(NewBox(4, 12, -2, armWidth, 12, 4, 48, 48, 0.25)))
+			model.RightLeg.Boxes = append(model.RightLeg.Boxes, overlayBox(NewBox(-4, 0, -2, 4, 12, 4, 0, 32, 0.25)))
+			model.LeftLeg.Boxes = append(model.LeftLeg.Boxes, overlayBox(NewBox(0, 0, -2, 4, 12, 4, 0, 48, 0.25)))
+		}
+	}
+
+	for _, part := range model.Parts() {
+		part.Texture = skin
+		part.TextureWidth = 64
+	}
+
+	return model
+}
+
+// Parts returns all parts of the player model, where attachments such as the cape are children of the body.
+func (m *PlayerModel) Parts() []*Part {
+	return []*Part{m.Head, m.Body, m.RightArm, m.LeftArm, m.RightLeg, m.LeftLeg}
+}
+
+func opaqueBox(b Box) Box {
+	b.Opaque = true
+
+	return b
+}
+
+func overlayBox(b Box) Box {
+	b.Overlay = true
+
+	return b
+}
+
+func mirroredBox(b Box) Box {
+	b.Mirror = true
+
+	return b
+}
@@ -0,0 +1,68 @@
+package render
+
+// Pose is the rotation in degrees of the head and limbs of the player model, relative to standing upright.
+type Pose struct {
+	// HeadYaw turns the head to the right of the player for positive values, the same direction as yaw in-game.
+	HeadYaw float64
+	// HeadPitch tilts the head downwards for positive values, the same direction as pitch in-game.
+	HeadPitch float64
+	// RightArmPitch swings the right arm forwards for positive values.
+	RightArmPitch float64
+	// RightArmRoll raises the right arm away from the body for positive values.
+	RightArmRoll float64
+	// LeftArmPitch swings the left arm forwards for positive values.
+	LeftArmPitch float64
+	// LeftArmRoll raises the left arm away from the body for positive values.
+	LeftArmRoll float64
+	// RightLegPitch swings the right leg forwards for positive values.
+	RightLegPitch float64
+	// RightLegRoll raises the right leg away from the body for positive values.
+	RightLegRoll float64
+	// LeftLegPitch swings the left leg forwards for positive values.
+	LeftLegPitch float64
+	// LeftLegRoll raises the left leg away from the body for positive values.
+	LeftLegRoll float64
+}
+
+var (
+	// PoseStanding is the default pose of the player, standing upright.
+	PoseStanding Pose = Pose{}
+	// PoseWalking is the pose of the player mid-stride.
+	PoseWalking Pose = Pose{
+		RightArmPitch: 30,
+		LeftArmPitch:  -30,
+		RightLegPitch: -30,
+		LeftLegPitch:  30,
+	}
+	// PoseWaving is the pose of the player waving with their right arm.
+	PoseWaving Pose = Pose{
+		HeadPitch:    -5,
+		RightArmRoll: 150,
+		LeftArmRoll:  5,
+	}
+	// PoseSitting is the pose of the player sitting down, like when riding an entity.
+	PoseSitting Pose = Pose{
+		RightArmPitch: 36,
+		LeftArmPitch:  36,
+		RightLegPitch: 80,
+		RightLegRoll:  5,
+		LeftLegPitch:  80,
+		LeftLegRoll:   5,
+	}
+	// Poses is a map of all named poses by their name.
+	Poses map[string]Pose = map[string]Pose{
+		"standing": PoseStanding,
+		"walking":  PoseWalking,
+		"waving":   PoseWaving,
+		"sitting":  PoseSitting,
+	}
+)
+
+// SetPose rotates the head and limbs of the player model into the pose.
+func (m *PlayerModel) SetPose(pose Pose) {
+	m.Head.Rotation = Vec3{pose.HeadPitch, -pose.HeadYaw, 0}
+	m.RightArm.Rotation = Vec3{-pose.RightArmPitch, 0, -pose.RightArmRoll}
+	m.LeftArm.Rotation = Vec3{-pose.LeftArmPitch, 0, pose.LeftArmRoll}
+	m.RightLeg.Rotation = Vec3{-pose.RightLegPitch, 0, -pose.RightLegRoll}
+	m.LeftLeg.Rotation = Vec3{-pose.LeftLegPitch, 0, pose.LeftLegRoll}
+}
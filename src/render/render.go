@@ -0,0 +1,402 @@
+package render
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// edgeTolerance is how far outside of a face a pixel may be sampled, which prevents gaps along the edges between faces.
+const edgeTolerance = 1e-6
+
+// Box is a textured cuboid, with the texture laid out the same way as the boxes of Minecraft entity models.
+type Box struct {
+	// Min is the corner of the box with the lowest coordinates.
+	Min Vec3
+	// Max is the corner of the box with the highest coordinates.
+	Max Vec3
+	// U is the horizontal offset of the box texture, in units of the part texture width.
+	U int
+	// V is the vertical offset of the box texture, in units of the part texture width.
+	V int
+	// Width is the size of the box texture along the X axis.
+	Width int
+	// Height is the size of the box texture along the Y axis.
+	Height int
+	// Depth is the size of the box texture along the Z axis.
+	Depth int
+	// Mirror flips the texture horizontally and swaps the left and right sides, like mirrored model boxes in Minecraft.
+	Mirror bool
+	// Overlay marks the box as an outer layer, which is drawn after all other boxes so translucent pixels blend properly.
+	Overlay bool
+	// Opaque ignores the alpha channel of the texture, which the base layer of a skin always does.
+	Opaque bool
+}
+
+// NewBox returns a box at the position with the size of its texture, grown in every direction by the inflation value.
+func NewBox(x, y, z float64, width, height, depth, u, v int, inflate float64) Box {
+	return Box{
+		Min:    Vec3{x - inflate, y - inflate, z - inflate},
+		Max:    Vec3{x + float64(width) + inflate, y + float64(height) + inflate, z + float64(depth) + inflate},
+		U:      u,
+		V:      v,
+		Width:  width,
+		Height: height,
+		Depth:  depth,
+	}
+}
+
+// Part is a group of boxes that share a texture and are rotated together around a pivot point.
+type Part struct {
+	// Texture is the image the boxes of the part are textured from.
+	Texture *image.NRGBA
+	// TextureWidth is the width the texture offsets of the boxes are relative to, allowing high resolution textures.
+	TextureWidth int
+	// Boxes are the cuboids that make up the part.
+	Boxes []Box
+	// Pivot is the point the part is rotated around.
+	Pivot Vec3
+	// Rotation is the rotation of the part in degrees around the X, Y and Z axis, applied in Z, Y, X order like Minecraft.
+	Rotation Vec3
+	// Children are parts attached to this part, which follow its rotation.
+	Children []*Part
+	// Hidden skips rendering the part and its children.
+	Hidden bool
+}
+
+// Options is the set of values used to render parts into an image.
+type Options struct {
+	// Scale is the amount of output pixels for each texture pixel.
+	Scale int
+	// Yaw is the angle in degrees the camera is turned around the model, where positive values show the right side of the player.
+	Yaw float64
+	// Pitch is the angle in degrees the camera looks down onto the model, where positive values show the top of the player.
+	Pitch float64
+	// Square pads the output image so that it is square, keeping the model in the center.
+	Square bool
+}
+
+type face struct {
+	origin Vec3
+	u      Vec3
+	v      Vec3
+	normal Vec3
+	rect   image.Rectangle
+}
+
+type renderBox struct {
+	box       Box
+	part      *Part
+	transform Transform
+}
+
+// renderFace is a side of a box along with the camera space depth of its center, where a greater depth is closer to the camera.
+type renderFace struct {
+	box   renderBox
+	face  face
+	depth float64
+}
+
+// Render renders the parts with an orthographic projection from the camera angle in the options, and returns the result.
+func Render(parts []*Part, opts Options) *image.NRGBA {
+	boxes := collectBoxes(parts, getCamera(opts.Yaw, opts.Pitch))
+	lower, upper := getBounds(boxes)
+
+	return rasterize(boxes, lower, upper, opts)
+}
+
+// RenderTurntable renders the parts from the amount of camera angles evenly spread around the model, starting at the camera
+// angle in the options. All frames are the same size, with the model at the same position in each one.
+func RenderTurntable(parts []*Part, opts Options, frames int) []*image.NRGBA {
+	var (
+		frameBoxes [][]renderBox  = make([][]renderBox, frames)
+		lower      Vec3           = Vec3{math.Inf(1), math.Inf(1), 0}
+		upper      Vec3           = Vec3{math.Inf(-1), math.Inf(-1), 0}
+		result     []*image.NRGBA = make([]*image.NRGBA, frames)
+	)
+
+	for i := 0; i < frames; i++ {
+		frameBoxes[i] = collectBoxes(parts, getCamera(opts.Yaw+float64(i)*360/float64(frames), opts.Pitch))
+
+		frameLower, frameUpper := getBounds(frameBoxes[i])
+
+		lower.X, lower.Y = math.Min(lower.X, frameLower.X), math.Min(lower.Y, frameLower.Y)
+		upper.X, upper.Y = math.Max(upper.X, frameUpper.X), math.Max(upper.Y, frameUpper.Y)
+	}
+
+	for i, boxes := range frameBoxes {
+		result[i] = rasterize(boxes, lower, upper, opts)
+	}
+
+	return result
+}
+
+// getCamera returns the transform from model space into camera space for the camera angle.
+func getCamera(yaw, pitch float64) Transform {
+	return Transform{Rotation: RotationX(pitch).Multiply(RotationY(yaw))}
+}
+
+// getBounds returns the lowest and highest camera space coordinates of all boxes.
+func getBounds(boxes []renderBox) (Vec3, Vec3) {
+	var (
+		lower Vec3 = Vec3{math.Inf(1), math.Inf(1), 0}
+		upper Vec3 = Vec3{math.Inf(-1), math.Inf(-1), 0}
+	)
+
+	for _, b := range boxes {
+		for _, corner := range b.box.corners() {
+			p := b.transform.Apply(corner)
+
+			lower.X, lower.Y = math.Min(lower.X, p.X), math.Min(lower.Y, p.Y)
+			upper.X, upper.Y = math.Max(upper.X, p.X), math.Max(upper.Y, p.Y)
+		}
+	}
+
+	return lower, upper
+}
+
+// rasterize draws the boxes into an image covering the area between the lowest and highest camera space coordinates.
+func rasterize(boxes []renderBox, lower, upper Vec3, opts Options) *image.NRGBA {
+	if len(boxes) < 1 {
+		return image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	}
+
+	var (
+		scale  float64      = float64(opts.Scale)
+		width  int          = int(math.Ceil((upper.X-lower.X)*scale - 1e-6))
+		height int          = int(math.Ceil((upper.Y-lower.Y)*scale - 1e-6))
+		output *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, width, height))
+		depth  []float64    = make([]float64, width*height)
+	)
+
+	for i := range depth {
+		depth[i] = math.Inf(-1)
+	}
+
+	// All base boxes are drawn before the overlay boxes so that translucent overlay pixels are blended on top of what is behind them.
+	// Translucent pixels do not hide what is behind them, so the overlay faces are drawn from back to front to blend them in order.
+	overlayFaces := make([]renderFace, 0)
+
+	for _, b := range boxes {
+		for _, f := range b.box.faces() {
+			if !b.box.Overlay {
+				drawFace(output, depth, b, f, lower.X, upper.Y, scale)
+
+				continue
+			}
+
+			center := b.transform.Apply(f.origin.Add(f.u.Scale(0.5)).Add(f.v.Scale(0.5)))
+
+			overlayFaces = append(overlayFaces, renderFace{b, f, center.Z})
+		}
+	}
+
+	sort.SliceStable(overlayFaces, func(i, j int) bool {
+		return overlayFaces[i].depth < overlayFaces[j].depth
+	})
+
+	for _, f := range overlayFaces {
+		drawFace(output, depth, f.box, f.face, lower.X, upper.Y, scale)
+	}
+
+	if opts.Square {
+		return squareAndCenter(output)
+	}
+
+	return output
+}
+
+func collectBoxes(parts []*Part, parent Transform) []renderBox {
+	result := make([]renderBox, 0)
+
+	for _, part := range parts {
+		if part.Hidden {
+			continue
+		}
+
+		rotation := RotationZ(part.Rotation.Z).Multiply(RotationY(part.Rotation.Y)).Multiply(RotationX(part.Rotation.X))
+
+		transform := Transform{
+			Rotation:    rotation,
+			Translation: part.Pivot.Sub(rotation.Apply(part.Pivot)),
+		}.Then(parent)
+
+		for _, box := range part.Boxes {
+			result = append(result, renderBox{
+				box:       box,
+				part:      part,
+				transform: transform,
+			})
+		}
+
+		result = append(result, collectBoxes(part.Children, transform)...)
+	}
+
+	return result
+}
+
+func (b Box) corners() []Vec3 {
+	return []Vec3{
+		{b.Min.X, b.Min.Y, b.Min.Z},
+		{b.Max.X, b.Min.Y, b.Min.Z},
+		{b.Min.X, b.Max.Y, b.Min.Z},
+		{b.Max.X, b.Max.Y, b.Min.Z},
+		{b.Min.X, b.Min.Y, b.Max.Z},
+		{b.Max.X, b.Min.Y, b.Max.Z},
+		{b.Min.X, b.Max.Y, b.Max.Z},
+		{b.Max.X, b.Max.Y, b.Max.Z},
+	}
+}
+
+// faces returns the six sides of the box along with where each one is located within the texture.
+func (b Box) faces() []face {
+	var (
+		w, h, d    int             = b.Width, b.Height, b.Depth
+		dx, dy, dz float64         = b.Max.X - b.Min.X, b.Max.Y - b.Min.Y, b.Max.Z - b.Min.Z
+		rightRect  image.Rectangle = image.Rect(b.U, b.V+d, b.U+d, b.V+d+h)
+		leftRect   image.Rectangle = image.Rect(b.U+d+w, b.V+d, b.U+d+w+d, b.V+d+h)
+	)
+
+	if b.Mirror {
+		rightRect, leftRect = leftRect, rightRect
+	}
+
+	return []face{
+		// Front
+		{
+			origin: Vec3{b.Min.X, b.Max.Y, b.Max.Z},
+			u:      Vec3{dx, 0, 0},
+			v:      Vec3{0, -dy, 0},
+			normal: Vec3{0, 0, 1},
+			rect:   image.Rect(b.U+d, b.V+d, b.U+d+w, b.V+d+h),
+		},
+		// Back
+		{
+			origin: Vec3{b.Max.X, b.Max.Y, b.Min.Z},
+			u:      Vec3{-dx, 0, 0},
+			v:      Vec3{0, -dy, 0},
+			normal: Vec3{0, 0, -1},
+			rect:   image.Rect(b.U+d+w+d, b.V+d, b.U+d+w+d+w, b.V+d+h),
+		},
+		// Right
+		{
+			origin: Vec3{b.Min.X, b.Max.Y, b.Min.Z},
+			u:      Vec3{0, 0, dz},
+			v:      Vec3{0, -dy, 0},
+			normal: Vec3{-1, 0, 0},
+			rect:   rightRect,
+		},
+		// Left
+		{
+			origin: Vec3{b.Max.X, b.Max.Y, b.Max.Z},
+			u:      Vec3{0, 0, -dz},
+			v:      Vec3{0, -dy, 0},
+			normal: Vec3{1, 0, 0},
+			rect:   leftRect,
+		},
+		// Top
+		{
+			origin: Vec3{b.Min.X, b.Max.Y, b.Min.Z},
+			u:      Vec3{dx, 0, 0},
+			v:      Vec3{0, 0, dz},
+			normal: Vec3{0, 1, 0},
+			rect:   image.Rect(b.U+d, b.V, b.U+d+w, b.V+d),
+		},
+		// Bottom
+		{
+			origin: Vec3{b.Min.X, b.Min.Y, b.Min.Z},
+			u:      Vec3{dx, 0, 0},
+			v:      Vec3{0, 0, dz},
+			normal: Vec3{0, -1, 0},
+			rect:   image.Rect(b.U+d+w, b.V, b.U+d+w+w, b.V+d),
+		},
+	}
+}
+
+// drawFace rasterizes a single side of a box into the output image, only drawing pixels that are closer than what was
+// previously drawn at the same position.
+func drawFace(output *image.NRGBA, depth []float64, b renderBox, f face, offsetX, offsetY, scale float64) {
+	// Sides facing away from the camera are hidden behind the rest of the box
+	if b.transform.Rotation.Apply(f.normal).Z <= 0 {
+		return
+	}
+
+	var (
+		origin       Vec3            = b.transform.Apply(f.origin)
+		u            Vec3            = b.transform.Rotation.Apply(f.u)
+		v            Vec3            = b.transform.Rotation.Apply(f.v)
+		ox           float64         = (origin.X - offsetX) * scale
+		oy           float64         = (offsetY - origin.Y) * scale
+		ux, uy       float64         = u.X * scale, -u.Y * scale
+		vx, vy       float64         = v.X * scale, -v.Y * scale
+		determinant  float64         = ux*vy - uy*vx
+		texture      *image.NRGBA    = b.part.Texture
+		textureScale int             = max(texture.Bounds().Dx()/b.part.TextureWidth, 1)
+		textureRect  image.Rectangle = image.Rect(f.rect.Min.X*textureScale, f.rect.Min.Y*textureScale, f.rect.Max.X*textureScale, f.rect.Max.Y*textureScale).Add(texture.Bounds().Min)
+		bounds       image.Rectangle = output.Bounds()
+	)
+
+	if math.Abs(determinant) < 1e-9 || !textureRect.In(texture.Bounds()) {
+		return
+	}
+
+	var (
+		minX int             = int(math.Floor(math.Min(math.Min(ox, ox+ux), math.Min(ox+vx, ox+ux+vx))))
+		maxX int             = int(math.Ceil(math.Max(math.Max(ox, ox+ux), math.Max(ox+vx, ox+ux+vx))))
+		minY int             = int(math.Floor(math.Min(math.Min(oy, oy+uy), math.Min(oy+vy, oy+uy+vy))))
+		maxY int             = int(math.Ceil(math.Max(math.Max(oy, oy+uy), math.Max(oy+vy, oy+uy+vy))))
+		rect image.Rectangle = image.Rect(minX, minY, maxX, maxY).Intersect(bounds)
+	)
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			px, py := float64(x)+0.5-ox, float64(y)+0.5-oy
+
+			// Solve for the position within the face from the position of the pixel
+			s := (px*vy - py*vx) / determinant
+			t := (ux*py - uy*px) / determinant
+
+			if s < -edgeTolerance || t < -edgeTolerance || s > 1+edgeTolerance || t > 1+edgeTolerance {
+				continue
+			}
+
+			z := origin.Z + s*u.Z + t*v.Z
+			depthIndex := y*bounds.Dx() + x
+
+			if z <= depth[depthIndex] {
+				continue
+			}
+
+			if b.box.Mirror {
+				s = 1 - s
+			}
+
+			tx := textureRect.Min.X + clamp(int(s*float64(textureRect.Dx())), 0, textureRect.Dx()-1)
+			ty := textureRect.Min.Y + clamp(int(t*float64(textureRect.Dy())), 0, textureRect.Dy()-1)
+
+			textureIndex := texture.PixOffset(tx, ty)
+			color := []uint8{texture.Pix[textureIndex], texture.Pix[textureIndex+1], texture.Pix[textureIndex+2], texture.Pix[textureIndex+3]}
+
+			if b.box.Opaque {
+				color[3] = math.MaxUint8
+			}
+
+			if color[3] == 0 {
+				continue
+			}
+
+			outputIndex := output.PixOffset(x, y)
+
+			// Only fully opaque pixels hide what is behind them, translucent pixels are blended with what was already drawn
+			if color[3] == math.MaxUint8 {
+				copy(output.Pix[outputIndex:outputIndex+4], color)
+
+				depth[depthIndex] = z
+
+				continue
+			}
+
+			compositeColors(output.Pix[outputIndex:outputIndex+4], color)
+		}
+	}
+}
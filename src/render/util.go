@@ -0,0 +1,50 @@
+package render
+
+import "image"
+
+func clamp(value, min, max int) int {
+	if value > max {
+		return max
+	}
+
+	if value < min {
+		return min
+	}
+
+	return value
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// compositeColors blends the source color on top of the output color, using the same math as draw.Draw().
+func compositeColors(outputColor, sourceColor []uint8) {
+	sourceAlpha := uint32(sourceColor[3]) * 0x101
+
+	alphaOffset := ((1<<16 - 1) - sourceAlpha) * 0x101
+
+	outputColor[0] = uint8((uint32(outputColor[0])*alphaOffset/(1<<16-1) + (uint32(sourceColor[0]) * sourceAlpha / 0xff)) >> 8)
+	outputColor[1] = uint8((uint32(outputColor[1])*alphaOffset/(1<<16-1) + (uint32(sourceColor[1]) * sourceAlpha / 0xff)) >> 8)
+	outputColor[2] = uint8((uint32(outputColor[2])*alphaOffset/(1<<16-1) + (uint32(sourceColor[2]) * sourceAlpha / 0xff)) >> 8)
+	outputColor[3] = uint8((uint32(outputColor[3])*alphaOffset/(1<<16-1) + sourceAlpha) >> 8)
+}
+
+func squareAndCenter(img *image.NRGBA) *image.NRGBA {
+	var (
+		size    int          = max(img.Rect.Dx(), img.Rect.Dy())
+		offsetX int          = (size - img.Rect.Dx()) / 2
+		offsetY int          = (size - img.Rect.Dy()) / 2
+		output  *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, size, size))
+	)
+
+	for y := 0; y < img.Rect.Dy(); y++ {
+		copy(output.Pix[output.PixOffset(offsetX, offsetY+y):output.PixOffset(offsetX+img.Rect.Dx(), offsetY+y)], img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):img.PixOffset(img.Rect.Max.X, img.Rect.Min.Y+y)])
+	}
+
+	return output
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"image"
 
+	"github.com/mineatar-io/api-server/src/render"
 	"github.com/mineatar-io/skin-render"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -15,12 +17,57 @@ var (
 	RenderTypeRightBody = "rightbody"
 	RenderTypeFace      = "face"
 	RenderTypeHead      = "head"
+	RenderTypeBody3D    = "body3d"
+	RenderTypeHead3D    = "head3d"
+	RenderTypeTurntable = "turntable"
+	// modelCameraAngles is the camera yaw and pitch of the player model matching each flat body render, used when the
+	// options can only be rendered using the player model. The `yaw` and `pitch` query parameters only apply to the 3D routes,
+	// so posed renders of the flat routes are always viewed from these angles.
+	modelCameraAngles map[string][2]int = map[string][2]int{
+		RenderTypeFullBody:  {45, 35},
+		RenderTypeFrontBody: {0, 0},
+		RenderTypeBackBody:  {180, 0},
+		RenderTypeLeftBody:  {270, 0},
+		RenderTypeRightBody: {90, 0},
+	}
+	// renderFlight is used to share the result of a render between concurrent requests for the same result.
+	renderFlight *singleflight.Group = &singleflight.Group{}
 )
 
-// Render will render the image using the specified details and return the result.
-func Render(renderType, uuid string, rawSkin *image.NRGBA, isSlim bool, opts *QueryParams) ([]byte, bool, error) {
+// Render will render the image using the specified details and return the result, which is cached by the result cache key. The
+// cape is the one returned by GetRenderCape, and renders with a fallback are neither cached nor read from the cache.
+func Render(renderType, resultKey string, rawSkin *image.NRGBA, isSlim bool, rawCape *image.NRGBA, fallback string, opts *QueryParams) ([]byte, bool, error) {
+	if len(fallback) > 0 {
+		data, err := RenderImage(renderType, rawSkin, isSlim, rawCape, opts)
+
+		return data, false, err
+	}
+
+	// Concurrent requests for the same result within this process share a single render, and only one of them uses the cache and
+	// the lock shared with other processes
+	result, err, _ := renderFlight.Do(fmt.Sprintf("render-lock:%s", resultKey), func() (interface{}, error) {
+		data, cache, err := renderCached(renderType, resultKey, rawSkin, isSlim, rawCape, opts)
+
+		return &renderResult{data, cache}, err
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return result.(*renderResult).Data, result.(*renderResult).Cache, nil
+}
+
+// renderResult is the result of Render shared by concurrent requests for the same result.
+type renderResult struct {
+	Data  []byte
+	Cache bool
+}
+
+// renderCached renders the image the same as Render, without sharing the result with concurrent requests.
+func renderCached(renderType, resultKey string, rawSkin *image.NRGBA, isSlim bool, rawCape *image.NRGBA, opts *QueryParams) ([]byte, bool, error) {
 	if config.Cache.EnableLocks {
-		mutex := r.NewMutex(fmt.Sprintf("render-lock:%s-%d-%t-%s", renderType, opts.Scale, opts.Overlay, uuid))
+		mutex := r.NewMutex(fmt.Sprintf("render-lock:%s", resultKey))
 		mutex.Lock()
 
 		defer mutex.Unlock()
@@ -28,7 +75,7 @@ func Render(renderType, uuid string, rawSkin *image.NRGBA, isSlim bool, opts *Qu
 
 	// Fetch the existing render from cache if it exists
 	{
-		cache, err := GetCachedRenderResult(renderType, uuid, opts)
+		cache, err := GetCachedRenderResult(resultKey)
 
 		if err != nil {
 			return nil, false, err
@@ -39,8 +86,28 @@ func Render(renderType, uuid string, rawSkin *image.NRGBA, isSlim bool, opts *Qu
 		}
 	}
 
+	data, err := RenderImage(renderType, rawSkin, isSlim, rawCape, opts)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Put the result into the cache for later use
+	{
+		if err = SetCachedRenderResult(resultKey, data); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return data, false, nil
+}
+
+// RenderImage renders the skin using the specified details and returns the encoded result, without using the cache. The cape is
+// only used by renders of the player model, and may be nil.
+func RenderImage(renderType string, rawSkin *image.NRGBA, isSlim bool, cape *image.NRGBA, opts *QueryParams) ([]byte, error) {
 	var (
 		result     *image.NRGBA
+		frames     []*image.NRGBA
 		renderOpts skin.Options = skin.Options{
 			Overlay: opts.Overlay,
 			Slim:    isSlim,
@@ -49,8 +116,10 @@ func Render(renderType, uuid string, rawSkin *image.NRGBA, isSlim bool, opts *Qu
 		}
 	)
 
-	// Render the image based on the type provided
-	{
+	// Render the image based on the type provided, see modelCameraAngles for the flat body renders using the player model
+	if angles, ok := modelCameraAngles[renderType]; ok && opts.RequiresModel(cape) {
+		result = renderPlayerModel(rawSkin, isSlim, cape, opts, angles[0], angles[1])
+	} else {
 		switch renderType {
 		case RenderTypeFullBody:
 			{
@@ -92,6 +161,26 @@ func Render(renderType, uuid string, rawSkin *image.NRGBA, isSlim bool, opts *Qu
 			{
 				result = skin.RenderFace(rawSkin, renderOpts)
 
+				break
+			}
+		case RenderTypeBody3D:
+			{
+				result = renderPlayerModel(rawSkin, isSlim, cape, opts, opts.Yaw, opts.Pitch)
+
+				break
+			}
+		case RenderTypeHead3D:
+			{
+				model := render.NewPlayerModel(rawSkin, isSlim, opts.Overlay)
+
+				result = render.Render([]*render.Part{model.Head}, getRenderOptions(opts, opts.Yaw, opts.Pitch))
+
+				break
+			}
+		case RenderTypeTurntable:
+			{
+				frames = render.RenderTurntable(getPlayerModel(rawSkin, isSlim, cape, opts).Parts(), getRenderOptions(opts, opts.Yaw, opts.Pitch), opts.Frames)
+
 				break
 			}
 		default:
@@ -99,26 +188,39 @@ func Render(renderType, uuid string, rawSkin *image.NRGBA, isSlim bool, opts *Qu
 		}
 	}
 
-	var (
-		data []byte
-		err  error
-	)
+	// Encode the image into the requested format in byte-array format, or as an animation if multiple frames were rendered
+	if frames != nil {
+		return EncodeAnimation(frames, opts.Delay, opts)
+	}
 
-	// Encode the image into a PNG in byte-array format
-	{
-		data, err = EncodeImage(result, opts)
+	return EncodeImage(result, opts)
+}
 
-		if err != nil {
-			return nil, false, err
-		}
-	}
+// renderPlayerModel renders the full player model in the pose from the options, viewed from the camera angle.
+func renderPlayerModel(rawSkin *image.NRGBA, isSlim bool, cape *image.NRGBA, opts *QueryParams, yaw, pitch int) *image.NRGBA {
+	return render.Render(getPlayerModel(rawSkin, isSlim, cape, opts).Parts(), getRenderOptions(opts, yaw, pitch))
+}
 
-	// Put the result into the cache for later use
-	{
-		if err = SetCachedRenderResult(renderType, uuid, opts, data); err != nil {
-			return nil, false, err
-		}
+// getPlayerModel returns the full player model in the pose from the options, wearing the cape or elytra if requested.
+func getPlayerModel(rawSkin *image.NRGBA, isSlim bool, cape *image.NRGBA, opts *QueryParams) *render.PlayerModel {
+	model := render.NewPlayerModel(rawSkin, isSlim, opts.Overlay)
+	model.SetPose(opts.Pose)
+
+	if opts.Elytra {
+		model.SetElytra(cape, opts.Spread)
+	} else if opts.Cape {
+		model.SetCape(cape)
 	}
 
-	return data, false, nil
+	return model
+}
+
+// getRenderOptions returns the options used to render the player model from the query parameters and camera angle.
+func getRenderOptions(opts *QueryParams, yaw, pitch int) render.Options {
+	return render.Options{
+		Scale:  opts.Scale,
+		Yaw:    float64(yaw),
+		Pitch:  float64(pitch),
+		Square: opts.Square,
+	}
 }
@@ -2,17 +2,23 @@ package main
 
 import (
 	"fmt"
+	"image"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/favicon"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/mineatar-io/skin-render"
 )
 
-func init() {
+// registerRoutes registers the middleware and every route of the API onto the app.
+func registerRoutes() {
 	app.Use(recover.New())
 
 	app.Use(favicon.New(favicon.Config{
@@ -22,8 +28,8 @@ func init() {
 	if config.Environment == "development" {
 		app.Use(cors.New(cors.Config{
 			AllowOrigins:  "*",
-			AllowMethods:  "HEAD,OPTIONS,GET",
-			ExposeHeaders: "X-Cache-Hit,X-Cache-Time-Remaining",
+			AllowMethods:  "HEAD,OPTIONS,GET,POST",
+			ExposeHeaders: "Age,ETag,X-Cache-Hit,X-Cache-Time-Remaining,X-Player-UUID,X-Skin-Fallback,X-Texture-Hash",
 		}))
 
 		app.Use(logger.New(logger.Config{
@@ -33,14 +39,33 @@ func init() {
 	}
 
 	app.Get("/ping", PingHandler)
-	app.Get("/skin/:uuid", SkinHandler)
-	app.Get("/face/:uuid", FaceHandler)
-	app.Get("/head/:uuid", HeadHandler)
-	app.Get("/body/full/:uuid", FullBodyHandler)
-	app.Get("/body/front/:uuid", FrontBodyHandler)
-	app.Get("/body/back/:uuid", BackBodyHandler)
-	app.Get("/body/left/:uuid", LeftBodyHandler)
-	app.Get("/body/right/:uuid", RightBodyHandler)
+	app.Get("/texture/:hash", TextureHandler)
+	app.Get("/render/:type", CustomSkinHandler)
+	app.Post("/render/:type", CustomSkinHandler)
+
+	// Every player route is also available under a provider prefix, which selects the skin provider the same as the `provider`
+	// query parameter
+	registerPlayerRoutes(app)
+	registerPlayerRoutes(app.Group("/provider/:provider"))
+}
+
+// registerPlayerRoutes registers the routes that render the skins of players onto the router.
+func registerPlayerRoutes(router fiber.Router) {
+	router.Get("/skin/:uuid", SkinHandler)
+	router.Get("/cape/:uuid", CapeHandler)
+	router.Get("/face/:uuid", RenderHandler(RenderTypeFace))
+	router.Get("/head/:uuid", RenderHandler(RenderTypeHead))
+	router.Get("/body/full/:uuid", RenderHandler(RenderTypeFullBody))
+	router.Get("/body/front/:uuid", RenderHandler(RenderTypeFrontBody))
+	router.Get("/body/back/:uuid", RenderHandler(RenderTypeBackBody))
+	router.Get("/body/left/:uuid", RenderHandler(RenderTypeLeftBody))
+	router.Get("/body/right/:uuid", RenderHandler(RenderTypeRightBody))
+	router.Get("/body/3d/:uuid", RenderHandler(RenderTypeBody3D))
+	router.Get("/head/3d/:uuid", RenderHandler(RenderTypeHead3D))
+	router.Get("/body/turntable/:uuid", RenderHandler(RenderTypeTurntable))
+	router.Post("/batch/:type", BatchHandler)
+	router.Get("/sheet/:type", SheetHandler)
+	router.Get("/sheet/:type/index", SheetIndexHandler)
 }
 
 // PingHandler is the API handler used for the `/ping` route.
@@ -56,272 +81,195 @@ func SkinHandler(ctx *fiber.Ctx) error {
 		return nil
 	}
 
-	uuid, ok := ParseUUID(ctx.Params("uuid"))
+	uuid, ok, err := ParsePlayer(ctx, ExtractUUID(ctx), opts.Provider)
 
 	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
-
-	rawSkin, _, err := GetPlayerSkin(uuid)
-
-	if err != nil {
 		return err
 	}
 
-	data, err := EncodeImage(rawSkin, opts)
+	rawSkin, isSlim, textureHash, fallback, err := GetPlayerSkin(uuid, opts.Provider)
 
 	if err != nil {
 		return err
 	}
 
-	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, uuid, opts.Format))
-	}
-
-	return ctx.Type(opts.Format).Send(data)
-}
-
-// FaceHandler is the API handler used for the `/face/:uuid` route.
-func FaceHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.Face)
+	// The texture hash allows clients to fetch the same skin from the texture route without resolving the player again
+	ctx.Set("X-Texture-Hash", textureHash)
 
-	if opts == nil {
-		return nil
-	}
-
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
-
-	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
+	if fresh, err := HandleConditionalRequest(ctx, GetResultCacheKey(uuid, "skin", textureHash, isSlim, opts), uuid, rawSkin, nil, fallback, opts); fresh || err != nil {
+		return err
 	}
 
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
+	data, err := EncodeImage(rawSkin, opts)
 
 	if err != nil {
 		return err
 	}
 
-	result, cache, err := Render(RenderTypeFace, uuid, rawSkin, isSlim, opts)
-
-	if err != nil {
+	if err = SetSkinCacheHeaders(ctx, uuid, opts); err != nil {
 		return err
 	}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
-
 	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
+		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, uuid, opts.Format))
 	}
 
-	return ctx.Type(opts.Format).Send(result)
+	return ctx.Type(opts.Format).Send(data)
 }
 
-// HeadHandler is the API handler used for the `/head/:uuid` route.
-func HeadHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.Head)
+// CapeHandler is the API handler used for the `/cape/:uuid` route.
+func CapeHandler(ctx *fiber.Ctx) error {
+	opts := ParseQueryParams(ctx, config.Routes.RawCape)
 
 	if opts == nil {
 		return nil
 	}
 
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
+	uuid, ok, err := ParsePlayer(ctx, ExtractUUID(ctx), opts.Provider)
 
 	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
-
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
-
-	if err != nil {
 		return err
 	}
 
-	result, cache, err := Render(RenderTypeHead, uuid, rawSkin, isSlim, opts)
+	rawCape, err := GetPlayerCape(uuid, opts.Provider)
 
 	if err != nil {
-		return err
-	}
-
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
+		log.Printf("Error: failed to fetch cape of %s: %v\n", uuid, err)
 
-	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
+		return ctx.Status(http.StatusBadGateway).SendString("Failed to fetch the cape from the skin provider")
 	}
 
-	return ctx.Type(opts.Format).Send(result)
-}
-
-// FullBodyHandler is the API handler used for the `/body/full/:uuid` route.
-func FullBodyHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.FullBody)
-
-	if opts == nil {
-		return nil
+	if rawCape == nil {
+		return ctx.Status(http.StatusNotFound).SendString("Player does not have a cape")
 	}
 
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
-
-	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
-
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
-
-	if err != nil {
+	if fresh, err := HandleConditionalRequest(ctx, GetResultCacheKey(uuid, "cape", "", false, opts), uuid, nil, rawCape, "", opts); fresh || err != nil {
 		return err
 	}
 
-	result, cache, err := Render(RenderTypeFullBody, uuid, rawSkin, isSlim, opts)
+	data, err := EncodeImage(rawCape, opts)
 
 	if err != nil {
 		return err
 	}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
-
 	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
+		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, uuid, opts.Format))
 	}
 
-	return ctx.Type(opts.Format).Send(result)
+	return ctx.Type(opts.Format).Send(data)
 }
 
-// FrontBodyHandler is the API handler used for the `/body/front/:uuid` route.
-func FrontBodyHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.FrontBody)
+// TextureHandler is the API handler used for the `/texture/:hash` route, which returns a skin by its texture hash if it is in
+// the cache, or one of the default skins.
+func TextureHandler(ctx *fiber.Ctx) error {
+	opts := ParseQueryParams(ctx, config.Routes.RawSkin)
 
 	if opts == nil {
 		return nil
 	}
 
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
-
-	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
-
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
+	var (
+		textureHash string       = strings.ToLower(ctx.Params("hash"))
+		rawSkin     *image.NRGBA = nil
+	)
 
-	if err != nil {
-		return err
-	}
-
-	result, cache, err := Render(RenderTypeFrontBody, uuid, rawSkin, isSlim, opts)
+	switch textureHash {
+	case DefaultClassicSkinHash, DefaultSlimSkinHash:
+		{
+			rawSkin = skin.GetDefaultSkin(textureHash == DefaultSlimSkinHash)
 
-	if err != nil {
-		return err
-	}
+			break
+		}
+	default:
+		{
+			if !textureHashRegExp.MatchString(textureHash) {
+				return ctx.Status(http.StatusBadRequest).SendString("Invalid texture hash")
+			}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
+			cache, ok, err := GetCachedTexture(textureHash)
 
-	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
-	}
+			if err != nil {
+				return err
+			}
 
-	return ctx.Type(opts.Format).Send(result)
-}
+			if !ok {
+				return ctx.Status(http.StatusNotFound).SendString("Unknown texture")
+			}
 
-// BackBodyHandler is the API handler used for the `/body/back/:uuid` route.
-func BackBodyHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.BackBody)
+			rawSkin = cache
 
-	if opts == nil {
-		return nil
+			break
+		}
 	}
 
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
+	// The texture of a hash never changes, so the ETag only depends on the hash and the options
+	etag := fmt.Sprintf(`"%s"`, GetResultCacheKey("", "texture", textureHash, false, opts))
 
-	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
+	ctx.Set(fiber.HeaderETag, etag)
+	ctx.Set(fiber.HeaderCacheControl, GetCacheControl())
 
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
-
-	if err != nil {
-		return err
+	if isFresh(ctx, etag, time.Time{}) {
+		return ctx.SendStatus(http.StatusNotModified)
 	}
 
-	result, cache, err := Render(RenderTypeBackBody, uuid, rawSkin, isSlim, opts)
+	data, err := EncodeImage(rawSkin, opts)
 
 	if err != nil {
 		return err
 	}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
-
 	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
+		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, textureHash, opts.Format))
 	}
 
-	return ctx.Type(opts.Format).Send(result)
+	return ctx.Type(opts.Format).Send(data)
 }
 
-// LeftBodyHandler is the API handler used for the `/body/left/:uuid` route.
-func LeftBodyHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.LeftBody)
-
-	if opts == nil {
-		return nil
-	}
-
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
-
-	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
-
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
+// RenderHandler returns the API handler used for the route of the render type, such as `/face/:uuid` for face renders.
+func RenderHandler(renderType string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		opts := ParseRenderParams(ctx, renderType)
 
-	if err != nil {
-		return err
-	}
+		if opts == nil {
+			return nil
+		}
 
-	result, cache, err := Render(RenderTypeLeftBody, uuid, rawSkin, isSlim, opts)
+		uuid, ok, err := ParsePlayer(ctx, ExtractUUID(ctx), opts.Provider)
 
-	if err != nil {
-		return err
-	}
+		if !ok {
+			return err
+		}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
+		rawSkin, isSlim, textureHash, fallback, err := GetPlayerSkin(uuid, opts.Provider)
 
-	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
-	}
+		if err != nil {
+			return err
+		}
 
-	return ctx.Type(opts.Format).Send(result)
-}
+		resultKey := GetResultCacheKey(uuid, renderType, textureHash, isSlim, opts)
+		rawCape, fallback := GetRenderCape(uuid, fallback, opts)
 
-// RightBodyHandler is the API handler used for the `/body/right/:uuid` route.
-func RightBodyHandler(ctx *fiber.Ctx) error {
-	opts := ParseQueryParams(ctx, config.Routes.RightBody)
+		if fresh, err := HandleConditionalRequest(ctx, resultKey, uuid, rawSkin, rawCape, fallback, opts); fresh || err != nil {
+			return err
+		}
 
-	if opts == nil {
-		return nil
-	}
+		result, cache, err := Render(renderType, resultKey, rawSkin, isSlim, rawCape, fallback, opts)
 
-	uuid, ok := ParseUUID(ExtractUUID(ctx))
+		if err != nil {
+			return err
+		}
 
-	if !ok {
-		return ctx.Status(http.StatusBadRequest).SendString("Invalid UUID")
-	}
+		if err = SetRenderCacheHeaders(ctx, resultKey); err != nil {
+			return err
+		}
 
-	rawSkin, isSlim, err := GetPlayerSkin(uuid)
+		ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
 
-	if err != nil {
-		return err
-	}
-
-	result, cache, err := Render(RenderTypeRightBody, uuid, rawSkin, isSlim, opts)
+		if opts.Download {
+			ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, uuid, opts.Format))
+		}
 
-	if err != nil {
-		return err
-	}
-
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
-
-	if opts.Download {
-		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, uuid))
+		return ctx.Type(opts.Format).Send(result)
 	}
-
-	return ctx.Type(opts.Format).Send(result)
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mineatar-io/skin-render"
+)
+
+var (
+	// sheetCellSizes is the size of the cells of sprite sheets by render type and options, see getSheetCellSize.
+	sheetCellSizes *sync.Map = &sync.Map{}
+)
+
+// SheetParams is the layout of a sprite sheet parsed from the query parameters.
+type SheetParams struct {
+	Players    []string
+	Columns    int
+	Padding    int
+	Background color.NRGBA
+}
+
+// SheetIndex is the JSON body of a response from the sprite sheet index route, describing where each player is in the sheet.
+type SheetIndex struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Cells  []*SheetCell `json:"cells"`
+}
+
+// SheetCell is the position of a single player within a sprite sheet. Players that failed to render keep their cell, which is
+// left empty, so the position of every other player does not depend on which players failed. The fallback is set when the cell
+// used a fallback skin, as the skin provider failed.
+type SheetCell struct {
+	Player   string `json:"player"`
+	UUID     string `json:"uuid,omitempty"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Fallback string `json:"fallback,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SheetHandler is the API handler used for the `/sheet/:type` route, where the type is either `face` or `head`.
+func SheetHandler(ctx *fiber.Ctx) error {
+	renderType, opts, sheet := ParseSheetParams(ctx)
+
+	if opts == nil {
+		return nil
+	}
+
+	cells, skins := ResolveSheet(opts, sheet)
+
+	// The sheet is not cached by clients if any of its cells used a fallback skin
+	for _, cell := range cells {
+		if len(cell.Fallback) > 0 {
+			SetSkinFallbackHeaders(ctx, cell.Fallback)
+
+			break
+		}
+	}
+
+	resultKey := GetSheetResultCacheKey(renderType, opts, sheet, cells, skins)
+
+	data, err := GetCachedRenderResult(resultKey)
+
+	if err != nil {
+		return err
+	}
+
+	cache := data != nil
+
+	if !cache {
+		if data, err = EncodeImage(RenderSheet(renderType, opts, sheet, cells, skins), opts); err != nil {
+			return err
+		}
+
+		if err = SetCachedRenderResult(resultKey, data); err != nil {
+			return err
+		}
+	}
+
+	if err = SetRenderCacheHeaders(ctx, resultKey); err != nil {
+		return err
+	}
+
+	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache))
+
+	if opts.Download {
+		ctx.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, renderType, opts.Format))
+	}
+
+	return ctx.Type(opts.Format).Send(data)
+}
+
+// SheetIndexHandler is the API handler used for the `/sheet/:type/index` route, which accepts the same query parameters as the
+// sprite sheet and returns the position of each player within it. The players are resolved, but nothing is rendered.
+func SheetIndexHandler(ctx *fiber.Ctx) error {
+	renderType, opts, sheet := ParseSheetParams(ctx)
+
+	if opts == nil {
+		return nil
+	}
+
+	cells, _ := ResolveSheet(opts, sheet)
+	width, height := LayoutSheet(renderType, opts, sheet, cells)
+
+	return ctx.JSON(SheetIndex{
+		Width:  width,
+		Height: height,
+		Cells:  cells,
+	})
+}
+
+// ParseSheetParams parses the render type from the route parameters, and the render options and layout of the sprite sheet
+// from the query parameters. If the render type is unknown or any query parameter is invalid, an error response is sent and nil
+// options are returned.
+func ParseSheetParams(ctx *fiber.Ctx) (string, *QueryParams, *SheetParams) {
+	renderType := ctx.Params("type")
+
+	if renderType != RenderTypeFace && renderType != RenderTypeHead {
+		ctx.Status(http.StatusNotFound).SendString("Unknown render type, sprite sheets only support face and head")
+
+		return "", nil, nil
+	}
+
+	opts := ParseQueryParams(ctx, config.Routes.Sheet.RouteConfig)
+
+	if opts == nil {
+		return "", nil, nil
+	}
+
+	sheet := &SheetParams{
+		Players: make([]string, 0),
+		Padding: Clamp(ctx.QueryInt("padding", 0), 0, config.Routes.Sheet.MaxPadding),
+	}
+
+	for _, player := range strings.Split(ctx.Query("players"), ",") {
+		if player = strings.TrimSpace(player); len(player) > 0 {
+			sheet.Players = append(sheet.Players, player)
+		}
+	}
+
+	if len(sheet.Players) < 1 {
+		ctx.Status(http.StatusBadRequest).SendString("No players were provided")
+
+		return "", nil, nil
+	}
+
+	if len(sheet.Players) > config.Routes.Sheet.MaxPlayers {
+		ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Too many players, the maximum is %d", config.Routes.Sheet.MaxPlayers))
+
+		return "", nil, nil
+	}
+
+	sheet.Columns = Clamp(ctx.QueryInt("columns", config.Routes.Sheet.DefaultColumns), 1, len(sheet.Players))
+
+	background, ok := ParseColor(ctx.Query("background", "00000000"))
+
+	if !ok {
+		ctx.Status(http.StatusBadRequest).SendString("Invalid 'background' query parameter")
+
+		return "", nil, nil
+	}
+
+	sheet.Background = background
+
+	return renderType, opts, sheet
+}
+
+// ParseColor parses a hexadecimal color in either the RRGGBB or RRGGBBAA format, with an optional leading "#".
+func ParseColor(value string) (color.NRGBA, bool) {
+	data, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+
+	switch len(data) {
+	case 3:
+		return color.NRGBA{R: data[0], G: data[1], B: data[2], A: 255}, true
+	case 4:
+		return color.NRGBA{R: data[0], G: data[1], B: data[2], A: data[3]}, true
+	default:
+		return color.NRGBA{}, false
+	}
+}
+
+// sheetSkin is the skin of a single player of a sprite sheet, which is nil if the player failed to resolve.
+type sheetSkin struct {
+	Raw         *image.NRGBA
+	Slim        bool
+	TextureHash string
+}
+
+// ResolveSheet resolves the players and their skins concurrently, returning the cell of each player in the same order as the
+// players along with their skins. The position of the cells is not set, see LayoutSheet.
+func ResolveSheet(opts *QueryParams, sheet *SheetParams) ([]*SheetCell, []*sheetSkin) {
+	var (
+		cells []*SheetCell = make([]*SheetCell, len(sheet.Players))
+		skins []*sheetSkin = make([]*sheetSkin, len(sheet.Players))
+	)
+
+	runConcurrently(len(sheet.Players), func(index int) {
+		cells[index] = &SheetCell{Player: sheet.Players[index]}
+
+		uuid, err := ResolvePlayer(sheet.Players[index], opts.Provider)
+
+		if err != nil {
+			cells[index].Error = playerError(sheet.Players[index], err)
+
+			return
+		}
+
+		cells[index].UUID = uuid
+
+		rawSkin, isSlim, textureHash, fallback, err := GetPlayerSkin(uuid, opts.Provider)
+
+		if err != nil {
+			cells[index].Error = playerError(sheet.Players[index], err)
+
+			return
+		}
+
+		cells[index].Fallback = fallback
+		skins[index] = &sheetSkin{rawSkin, isSlim, textureHash}
+	})
+
+	return cells, skins
+}
+
+// LayoutSheet arranges the cells into a grid and returns the size of the sprite sheet. Every cell has the same size, as the
+// renders only depend on the scale and not on the skin, so the layout only depends on the amount of players and the options.
+func LayoutSheet(renderType string, opts *QueryParams, sheet *SheetParams, cells []*SheetCell) (int, int) {
+	var (
+		cellSize image.Point = getSheetCellSize(renderType, opts)
+		rows     int         = (len(cells) + sheet.Columns - 1) / sheet.Columns
+	)
+
+	for index, cell := range cells {
+		cell.X = sheet.Padding + (index%sheet.Columns)*(cellSize.X+sheet.Padding)
+		cell.Y = sheet.Padding + (index/sheet.Columns)*(cellSize.Y+sheet.Padding)
+		cell.Width = cellSize.X
+		cell.Height = cellSize.Y
+	}
+
+	return sheet.Columns*(cellSize.X+sheet.Padding) + sheet.Padding, rows*(cellSize.Y+sheet.Padding) + sheet.Padding
+}
+
+// RenderSheet renders the resolved players concurrently and draws them into their cells of the sprite sheet, leaving the cells
+// of players that failed to resolve empty.
+func RenderSheet(renderType string, opts *QueryParams, sheet *SheetParams, cells []*SheetCell, skins []*sheetSkin) *image.NRGBA {
+	var (
+		width, height int          = LayoutSheet(renderType, opts, sheet, cells)
+		result        *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, width, height))
+	)
+
+	draw.Draw(result, result.Bounds(), image.NewUniform(sheet.Background), image.Point{}, draw.Src)
+
+	// Every cell is drawn into a separate area of the result, so the cells can be drawn concurrently
+	runConcurrently(len(cells), func(index int) {
+		if skins[index] == nil {
+			return
+		}
+
+		cell := cells[index]
+		cellRender := renderSheetCell(renderType, skins[index].Raw, skins[index].Slim, opts)
+
+		draw.Draw(result, image.Rect(cell.X, cell.Y, cell.X+cell.Width, cell.Y+cell.Height), cellRender, cellRender.Bounds().Min, draw.Over)
+	})
+
+	return result
+}
+
+// getSheetCellSize returns the size of the cells of a sprite sheet, which is measured once for each render type, scale and
+// square option using the default skin.
+func getSheetCellSize(renderType string, opts *QueryParams) image.Point {
+	key := fmt.Sprintf("%s:%d:%t", renderType, opts.Scale, opts.Square)
+
+	if size, ok := sheetCellSizes.Load(key); ok {
+		return size.(image.Point)
+	}
+
+	size := renderSheetCell(renderType, skin.GetDefaultSkin(false), false, opts).Bounds().Size()
+
+	sheetCellSizes.Store(key, size)
+
+	return size
+}
+
+// renderSheetCell renders the face or head of a single player of a sprite sheet.
+func renderSheetCell(renderType string, rawSkin *image.NRGBA, isSlim bool, opts *QueryParams) *image.NRGBA {
+	renderOpts := skin.Options{
+		Overlay: opts.Overlay,
+		Slim:    isSlim,
+		Scale:   opts.Scale,
+		Square:  opts.Square,
+	}
+
+	if renderType == RenderTypeHead {
+		return skin.RenderHead(rawSkin, renderOpts)
+	}
+
+	return skin.RenderFace(rawSkin, renderOpts)
+}
@@ -1,12 +1,10 @@
 package store
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"image"
-	"image/draw"
 	"log"
 	"os"
 	"path"
@@ -121,27 +119,37 @@ func (s *FileStore) runCleanup() error {
 }
 
 func (s *FileStore) GetBytes(key string) ([]byte, bool, error) {
-	expiration, err := os.ReadFile(path.Join(s.BaseDir, fmt.Sprintf("%s.expiration.txt", key)))
+	data, _, exists, err := s.GetBytesTTL(key)
 
-	if err == nil {
-		expirationDate, err := time.Parse(time.RFC3339, string(expiration))
+	return data, exists, err
+}
 
-		if err == nil && time.Now().After(expirationDate) {
-			return nil, false, nil
-		}
+func (s *FileStore) GetBytesTTL(key string) ([]byte, time.Duration, bool, error) {
+	expirationDate, err := s.readExpiration(key)
+
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if !expirationDate.IsZero() && time.Now().After(expirationDate) {
+		return nil, 0, false, nil
 	}
 
 	data, err := os.ReadFile(path.Join(s.BaseDir, fmt.Sprintf("%s.bin", key)))
 
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, false, nil
+			return nil, 0, false, nil
 		}
 
-		return nil, false, err
+		return nil, 0, false, err
+	}
+
+	if expirationDate.IsZero() {
+		return data, 0, true, nil
 	}
 
-	return data, true, nil
+	return data, time.Until(expirationDate), true, nil
 }
 
 func (s *FileStore) GetNRGBA(key string) (*image.NRGBA, bool, error) {
@@ -151,43 +159,67 @@ func (s *FileStore) GetNRGBA(key string) (*image.NRGBA, bool, error) {
 		return nil, exists, err
 	}
 
-	img, format, err := image.Decode(bytes.NewReader(data))
+	img, err := decodeNRGBA(data)
 
 	if err != nil {
 		return nil, false, err
 	}
 
-	if format != "NRGBA" {
-		outputImg := image.NewNRGBA(img.Bounds())
-
-		draw.Draw(outputImg, img.Bounds(), img, image.Pt(0, 0), draw.Src)
+	return img, true, nil
+}
 
-		return outputImg, true, nil
-	}
+func (s *FileStore) Exists(key string) (bool, error) {
+	_, exists, err := s.TTL(key)
 
-	return img.(*image.NRGBA), true, nil
+	return exists, err
 }
 
-func (s *FileStore) Exists(key string) (bool, error) {
-	expiration, err := os.ReadFile(path.Join(s.BaseDir, fmt.Sprintf("%s.expiration.txt", key)))
+func (s *FileStore) TTL(key string) (time.Duration, bool, error) {
+	expirationDate, err := s.readExpiration(key)
 
-	if err == nil {
-		expirationDate, err := time.Parse(time.RFC3339, string(expiration))
+	if err != nil {
+		return 0, false, err
+	}
 
-		if err == nil && time.Now().After(expirationDate) {
-			return false, nil
-		}
+	if !expirationDate.IsZero() && time.Now().After(expirationDate) {
+		return 0, false, nil
 	}
 
 	if _, err = os.Stat(path.Join(s.BaseDir, fmt.Sprintf("%s.bin", key))); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return false, nil
+			return 0, false, nil
 		}
 
-		return false, err
+		return 0, false, err
+	}
+
+	if expirationDate.IsZero() {
+		return 0, true, nil
+	}
+
+	return time.Until(expirationDate), true, nil
+}
+
+// readExpiration returns the time the value of the key expires, or the zero time if it does not expire or the expiration is
+// invalid.
+func (s *FileStore) readExpiration(key string) (time.Time, error) {
+	expiration, err := os.ReadFile(path.Join(s.BaseDir, fmt.Sprintf("%s.expiration.txt", key)))
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, err
+	}
+
+	expirationDate, err := time.Parse(time.RFC3339, string(expiration))
+
+	if err != nil {
+		return time.Time{}, nil
 	}
 
-	return true, nil
+	return expirationDate, nil
 }
 
 func (s *FileStore) SetBytes(key string, data []byte, ttl time.Duration) error {
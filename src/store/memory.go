@@ -0,0 +1,258 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mutex   sync.Mutex
+	items   map[string]*list.Element
+	order   *list.List
+	size    int64
+	MaxSize int64
+}
+
+type memoryItem struct {
+	key        string
+	data       []byte
+	expiration time.Time
+}
+
+func (s *MemoryStore) Initialize(config map[string]interface{}) error {
+	maxSize, err := parseSize(config["max_size"])
+
+	if err != nil {
+		return fmt.Errorf("memory: invalid max size value: %w", err)
+	}
+
+	s.MaxSize = maxSize
+	s.items = make(map[string]*list.Element)
+	s.order = list.New()
+	s.size = 0
+
+	return nil
+}
+
+func (s *MemoryStore) GetBytes(key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	item, ok := s.get(key)
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	return item.data, true, nil
+}
+
+func (s *MemoryStore) GetBytesTTL(key string) ([]byte, time.Duration, bool, error) {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	item, ok := s.get(key)
+
+	if !ok {
+		return nil, 0, false, nil
+	}
+
+	if item.expiration.IsZero() {
+		return item.data, 0, true, nil
+	}
+
+	return item.data, time.Until(item.expiration), true, nil
+}
+
+func (s *MemoryStore) GetNRGBA(key string) (*image.NRGBA, bool, error) {
+	data, exists, err := s.GetBytes(key)
+
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+
+	img, err := decodeNRGBA(data)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return img, true, nil
+}
+
+func (s *MemoryStore) Exists(key string) (bool, error) {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	_, ok := s.get(key)
+
+	return ok, nil
+}
+
+func (s *MemoryStore) TTL(key string) (time.Duration, bool, error) {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	// The item is looked up directly so that querying the TTL does not mark it as recently used
+	element, ok := s.items[key]
+
+	if !ok {
+		return 0, false, nil
+	}
+
+	item := element.Value.(*memoryItem)
+
+	if item.expiration.IsZero() {
+		return 0, true, nil
+	}
+
+	if time.Now().After(item.expiration) {
+		s.remove(element)
+
+		return 0, false, nil
+	}
+
+	return time.Until(item.expiration), true, nil
+}
+
+func (s *MemoryStore) SetBytes(key string, data []byte, ttl time.Duration) error {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+
+	item := &memoryItem{
+		key:  key,
+		data: data,
+	}
+
+	if ttl > 0 {
+		item.expiration = time.Now().Add(ttl)
+	}
+
+	// Items that can never fit within the budget are not stored at all
+	if item.size() > s.MaxSize {
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(item)
+	s.size += item.size()
+
+	for s.size > s.MaxSize {
+		s.remove(s.order.Back())
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	s.items = make(map[string]*list.Element)
+	s.order.Init()
+	s.size = 0
+
+	return nil
+}
+
+// get returns the item by the key and marks it as the most recently used, removing it if it has expired. The mutex must be held by the caller.
+func (s *MemoryStore) get(key string) (*memoryItem, bool) {
+	element, ok := s.items[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	item := element.Value.(*memoryItem)
+
+	if !item.expiration.IsZero() && time.Now().After(item.expiration) {
+		s.remove(element)
+
+		return nil, false
+	}
+
+	s.order.MoveToFront(element)
+
+	return item, true
+}
+
+// remove removes the element from the store. The mutex must be held by the caller.
+func (s *MemoryStore) remove(element *list.Element) {
+	item := s.order.Remove(element).(*memoryItem)
+
+	delete(s.items, item.key)
+
+	s.size -= item.size()
+}
+
+func (i *memoryItem) size() int64 {
+	return int64(len(i.key) + len(i.data))
+}
+
+// parseSize parses a byte size from the configuration, either as a plain number of bytes or as a string with a unit suffix such as "64MB".
+func parseSize(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case string:
+		{
+			v = strings.ToUpper(strings.TrimSpace(v))
+
+			units := []struct {
+				Suffix     string
+				Multiplier int64
+			}{
+				{"GB", 1 << 30},
+				{"MB", 1 << 20},
+				{"KB", 1 << 10},
+				{"B", 1},
+			}
+
+			for _, unit := range units {
+				if !strings.HasSuffix(v, unit.Suffix) {
+					continue
+				}
+
+				result, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(v, unit.Suffix)), 10, 64)
+
+				if err != nil {
+					return 0, err
+				}
+
+				return result * unit.Multiplier, nil
+			}
+
+			return strconv.ParseInt(v, 10, 64)
+		}
+	default:
+		return 0, fmt.Errorf("unexpected type: %T", value)
+	}
+}
+
+var _ Store = &MemoryStore{}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisURL is the connection URL used by RedisStore when the store configuration does not specify its own `url` value.
+var RedisURL string = ""
+
+type RedisStore struct {
+	Client  *redis.Client
+	Prefix  string
+	Timeout time.Duration
+}
+
+func (s *RedisStore) Initialize(config map[string]interface{}) error {
+	url := RedisURL
+
+	if value, ok := config["url"]; ok {
+		if url, ok = value.(string); !ok {
+			return fmt.Errorf("redis: invalid url value: %s", value)
+		}
+	}
+
+	if len(url) < 1 {
+		return errors.New("redis: missing url value")
+	}
+
+	s.Prefix = "store:"
+
+	if value, ok := config["prefix"]; ok {
+		if s.Prefix, ok = value.(string); !ok {
+			return fmt.Errorf("redis: invalid prefix value: %s", value)
+		}
+	}
+
+	s.Timeout = time.Second * 5
+
+	if value, ok := config["timeout"]; ok {
+		timeoutValue, ok := value.(string)
+
+		if !ok {
+			return fmt.Errorf("redis: invalid timeout value: %s", value)
+		}
+
+		timeout, err := time.ParseDuration(timeoutValue)
+
+		if err != nil {
+			return err
+		}
+
+		s.Timeout = timeout
+	}
+
+	opts, err := redis.ParseURL(url)
+
+	if err != nil {
+		return err
+	}
+
+	s.Client = redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	return s.Client.Ping(ctx).Err()
+}
+
+func (s *RedisStore) GetBytes(key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	data, err := s.Client.Get(ctx, s.Prefix+key).Bytes()
+
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+func (s *RedisStore) GetBytesTTL(key string) ([]byte, time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	var (
+		get  *redis.StringCmd
+		pttl *redis.DurationCmd
+	)
+
+	// Both commands are sent in a single transaction so the TTL belongs to the value that was read
+	if _, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, s.Prefix+key)
+		pttl = pipe.PTTL(ctx, s.Prefix+key)
+
+		return nil
+	}); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, 0, false, err
+	}
+
+	data, err := get.Bytes()
+
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, 0, false, nil
+		}
+
+		return nil, 0, false, err
+	}
+
+	// Redis replies with -1 if the key exists without an expiration
+	if ttl := pttl.Val(); ttl > 0 {
+		return data, ttl, true, nil
+	}
+
+	return data, 0, true, nil
+}
+
+func (s *RedisStore) GetNRGBA(key string) (*image.NRGBA, bool, error) {
+	data, exists, err := s.GetBytes(key)
+
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+
+	img, err := decodeNRGBA(data)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return img, true, nil
+}
+
+func (s *RedisStore) Exists(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	result, err := s.Client.Exists(ctx, s.Prefix+key).Result()
+
+	return result == 1, err
+}
+
+func (s *RedisStore) TTL(key string) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	result, err := s.Client.PTTL(ctx, s.Prefix+key).Result()
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	// Redis replies with -2 if the key does not exist, and -1 if the key exists without an expiration
+	switch result {
+	case -2:
+		return 0, false, nil
+	case -1:
+		return 0, true, nil
+	default:
+		return result, true, nil
+	}
+}
+
+func (s *RedisStore) SetBytes(key string, data []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	return s.Client.Set(ctx, s.Prefix+key, data, ttl).Err()
+}
+
+func (s *RedisStore) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	return s.Client.Del(ctx, s.Prefix+key).Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.Client.Close()
+}
+
+var _ Store = &RedisStore{}
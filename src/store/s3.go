@@ -0,0 +1,441 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const s3ExpirationHeader = "X-Amz-Meta-Expiration"
+
+type S3Store struct {
+	client       *http.Client
+	Endpoint     *url.URL
+	Bucket       string
+	Prefix       string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	PathStyle    bool
+	Timeout      time.Duration
+}
+
+func (s *S3Store) Initialize(config map[string]interface{}) error {
+	endpoint, ok := config["endpoint"].(string)
+
+	if !ok {
+		return fmt.Errorf("s3: invalid endpoint value: %s", config["endpoint"])
+	}
+
+	endpointURL, err := url.Parse(endpoint)
+
+	if err != nil {
+		return err
+	}
+
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return fmt.Errorf("s3: invalid endpoint scheme: %s", endpointURL.Scheme)
+	}
+
+	s.Endpoint = endpointURL
+
+	if s.Bucket, ok = config["bucket"].(string); !ok || len(s.Bucket) < 1 {
+		return fmt.Errorf("s3: invalid bucket value: %s", config["bucket"])
+	}
+
+	stringValues := []struct {
+		Key     string
+		Target  *string
+		Default string
+	}{
+		{"prefix", &s.Prefix, ""},
+		{"region", &s.Region, "us-east-1"},
+		{"access_key", &s.AccessKey, os.Getenv("AWS_ACCESS_KEY_ID")},
+		{"secret_key", &s.SecretKey, os.Getenv("AWS_SECRET_ACCESS_KEY")},
+		{"session_token", &s.SessionToken, os.Getenv("AWS_SESSION_TOKEN")},
+	}
+
+	for _, v := range stringValues {
+		*v.Target = v.Default
+
+		value, ok := config[v.Key]
+
+		if !ok {
+			continue
+		}
+
+		if *v.Target, ok = value.(string); !ok {
+			return fmt.Errorf("s3: invalid %s value: %v", v.Key, value)
+		}
+	}
+
+	s.PathStyle = true
+
+	if value, ok := config["path_style"]; ok {
+		if s.PathStyle, ok = value.(bool); !ok {
+			return fmt.Errorf("s3: invalid path_style value: %v", value)
+		}
+	}
+
+	s.Timeout = time.Second * 10
+
+	if value, ok := config["timeout"]; ok {
+		timeoutValue, ok := value.(string)
+
+		if !ok {
+			return fmt.Errorf("s3: invalid timeout value: %s", value)
+		}
+
+		timeout, err := time.ParseDuration(timeoutValue)
+
+		if err != nil {
+			return err
+		}
+
+		s.Timeout = timeout
+	}
+
+	s.client = &http.Client{}
+
+	return nil
+}
+
+func (s *S3Store) GetBytes(key string) ([]byte, bool, error) {
+	data, _, exists, err := s.GetBytesTTL(key)
+
+	return data, exists, err
+}
+
+func (s *S3Store) GetBytesTTL(key string) ([]byte, time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, false, fmt.Errorf("s3: unexpected response: %s", resp.Status)
+	}
+
+	// Expired objects are treated as missing, as S3 does not expire objects by their metadata. They are not deleted here since
+	// another process may have rewritten the key since it was read, so a lifecycle rule of the bucket must remove them instead.
+	if isExpired(resp.Header) {
+		return nil, 0, false, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	return data, getTTL(resp.Header), true, nil
+}
+
+func (s *S3Store) GetNRGBA(key string) (*image.NRGBA, bool, error) {
+	data, exists, err := s.GetBytes(key)
+
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+
+	img, err := decodeNRGBA(data)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return img, true, nil
+}
+
+func (s *S3Store) Exists(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("s3: unexpected response: %s", resp.Status)
+	}
+
+	return !isExpired(resp.Header), nil
+}
+
+func (s *S3Store) TTL(key string) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("s3: unexpected response: %s", resp.Status)
+	}
+
+	if isExpired(resp.Header) {
+		return 0, false, nil
+	}
+
+	return getTTL(resp.Header), true, nil
+}
+
+func (s *S3Store) SetBytes(key string, data []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	header := http.Header{}
+
+	if ttl > 0 {
+		header.Set(s3ExpirationHeader, time.Now().Add(ttl).Format(time.RFC3339))
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, header, data)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3: unexpected response: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3: unexpected response: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Close() error {
+	s.client.CloseIdleConnections()
+
+	return nil
+}
+
+// do sends a request for the object by the key to the bucket, signed using AWS Signature Version 4.
+func (s *S3Store) do(ctx context.Context, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	var (
+		host       string = s.Endpoint.Host
+		objectPath string = strings.TrimSuffix(s.Endpoint.Path, "/") + "/" + s.Bucket + "/" + s.Prefix + key
+	)
+
+	if !s.PathStyle {
+		host = s.Bucket + "." + s.Endpoint.Host
+		objectPath = strings.TrimSuffix(s.Endpoint.Path, "/") + "/" + s.Prefix + key
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s://%s", s.Endpoint.Scheme, host), bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.Path = objectPath
+	req.URL.RawPath = s3EscapePath(objectPath)
+	req.ContentLength = int64(len(body))
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if err = s.sign(req, body, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return s.client.Do(req)
+}
+
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) error {
+	if len(s.AccessKey) < 1 || len(s.SecretKey) < 1 {
+		return errors.New("s3: missing access key or secret key")
+	}
+
+	var (
+		payloadHash string = sha256Hex(body)
+		amzDate     string = now.Format("20060102T150405Z")
+		date        string = now.Format("20060102")
+		scope       string = fmt.Sprintf("%s/%s/s3/aws4_request", date, s.Region)
+	)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if len(s.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	headerNames := make([]string, 0, len(headers))
+
+	for k := range headers {
+		headerNames = append(headerNames, k)
+	}
+
+	sort.Strings(headerNames)
+
+	canonicalHeaders := &strings.Builder{}
+
+	for _, k := range headerNames {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(signingKey, stringToSign)),
+	))
+
+	return nil
+}
+
+func isExpired(header http.Header) bool {
+	expiration := header.Get(s3ExpirationHeader)
+
+	if len(expiration) < 1 {
+		return false
+	}
+
+	expirationDate, err := time.Parse(time.RFC3339, expiration)
+
+	return err == nil && time.Now().After(expirationDate)
+}
+
+// getTTL returns the remaining time of an object from its expiration metadata, or zero if it does not expire.
+func getTTL(header http.Header) time.Duration {
+	expirationDate, err := time.Parse(time.RFC3339, header.Get(s3ExpirationHeader))
+
+	if err != nil {
+		return 0
+	}
+
+	return time.Until(expirationDate)
+}
+
+// s3EscapePath encodes every byte of the path except for unreserved characters and slashes, as required by AWS Signature Version 4.
+func s3EscapePath(value string) string {
+	result := &strings.Builder{}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			result.WriteByte(c)
+
+			continue
+		}
+
+		fmt.Fprintf(result, "%%%02X", c)
+	}
+
+	return result.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+var _ Store = &S3Store{}
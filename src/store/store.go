@@ -1,13 +1,20 @@
 package store
 
 import (
+	"bytes"
+	"fmt"
 	"image"
+	"image/draw"
 	"time"
 )
 
 var (
-	StoreTypes map[string]Store = map[string]Store{
-		"filestore": &FileStore{},
+	StoreTypes map[string]func() Store = map[string]func() Store{
+		"filestore": func() Store { return &FileStore{} },
+		"redis":     func() Store { return &RedisStore{} },
+		"memory":    func() Store { return &MemoryStore{} },
+		"tiered":    func() Store { return &TieredStore{} },
+		"s3":        func() Store { return &S3Store{} },
 	}
 )
 
@@ -16,7 +23,53 @@ type Store interface {
 	GetBytes(id string) ([]byte, bool, error)
 	GetNRGBA(id string) (*image.NRGBA, bool, error)
 	Exists(id string) (bool, error)
+	// TTL returns the remaining time until the value expires and if it exists, where a value without an expiration has a zero
+	// duration remaining.
+	TTL(id string) (time.Duration, bool, error)
+	// GetBytesTTL returns the value along with its remaining time the same as TTL, reading both at once.
+	GetBytesTTL(id string) ([]byte, time.Duration, bool, error)
 	SetBytes(id string, data []byte, ttl time.Duration) error
 	Delete(id string) error
 	Close() error
 }
+
+// New creates a new store of the type specified by the `type` configuration value, and initializes it using the configuration.
+func New(config map[string]interface{}) (Store, error) {
+	storeType, ok := config["type"].(string)
+
+	if !ok {
+		return nil, fmt.Errorf("store: invalid type value: %T", config["type"])
+	}
+
+	newStore, ok := StoreTypes[storeType]
+
+	if !ok {
+		return nil, fmt.Errorf("store: unknown store type: %s", storeType)
+	}
+
+	s := newStore()
+
+	if err := s.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func decodeNRGBA(data []byte) (*image.NRGBA, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if format != "NRGBA" {
+		outputImg := image.NewNRGBA(img.Bounds())
+
+		draw.Draw(outputImg, img.Bounds(), img, image.Pt(0, 0), draw.Src)
+
+		return outputImg, nil
+	}
+
+	return img.(*image.NRGBA), nil
+}
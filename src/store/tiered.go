@@ -0,0 +1,279 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"log"
+	"time"
+)
+
+var (
+	// tieredHeader is the prefix of values in the faster tiers of a tiered store, which is followed by the time the value expires.
+	tieredHeader []byte = []byte("tiered:")
+)
+
+// TieredStore is a store that reads from the fastest of its tiers that has the value, and populates the faster tiers on a read
+// hit. Values in every tier except the slowest are stored with the time they expire, as their copies may expire sooner.
+type TieredStore struct {
+	Tiers       []Store
+	PopulateTTL time.Duration
+}
+
+func (s *TieredStore) Initialize(config map[string]interface{}) error {
+	tiers, ok := config["tiers"].([]interface{})
+
+	if !ok || len(tiers) < 1 {
+		return fmt.Errorf("tiered: invalid tiers value: %v", config["tiers"])
+	}
+
+	s.PopulateTTL = time.Minute * 5
+
+	if value, ok := config["populate_ttl"]; ok {
+		populateTTLValue, ok := value.(string)
+
+		if !ok {
+			return fmt.Errorf("tiered: invalid populate TTL value: %s", value)
+		}
+
+		populateTTL, err := time.ParseDuration(populateTTLValue)
+
+		if err != nil {
+			return err
+		}
+
+		s.PopulateTTL = populateTTL
+	}
+
+	s.Tiers = make([]Store, 0, len(tiers))
+
+	for i, value := range tiers {
+		tierConfig, ok := value.(map[string]interface{})
+
+		if !ok {
+			s.Close()
+
+			return fmt.Errorf("tiered: invalid tier #%d value: %v", i+1, value)
+		}
+
+		tier, err := New(tierConfig)
+
+		if err != nil {
+			s.Close()
+
+			return err
+		}
+
+		s.Tiers = append(s.Tiers, tier)
+	}
+
+	return nil
+}
+
+func (s *TieredStore) GetBytes(key string) ([]byte, bool, error) {
+	data, _, exists, err := s.GetBytesTTL(key)
+
+	return data, exists, err
+}
+
+func (s *TieredStore) GetBytesTTL(key string) ([]byte, time.Duration, bool, error) {
+	for i := range s.Tiers {
+		data, expiresAt, exists, err := s.getTier(i, key)
+
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		var ttl time.Duration = 0
+
+		if !expiresAt.IsZero() {
+			ttl = time.Until(expiresAt)
+		}
+
+		// Populate all of the faster tiers that missed so the next read is served by the first tier. The copies expire with the
+		// value, or after the populate TTL if that is sooner, and failing to populate does not fail the read.
+		if i > 0 {
+			populateTTL := s.PopulateTTL
+
+			if !expiresAt.IsZero() && ttl < populateTTL {
+				populateTTL = ttl
+			}
+
+			// The value expired while it was being read, and a TTL of zero would never expire
+			if populateTTL <= 0 {
+				return data, ttl, true, nil
+			}
+
+			for j := range s.Tiers[:i] {
+				if err = s.setTier(j, key, data, expiresAt, populateTTL); err != nil {
+					log.Printf("tiered: failed to populate tier #%d with %s: %v\n", j+1, key, err)
+				}
+			}
+		}
+
+		return data, ttl, true, nil
+	}
+
+	return nil, 0, false, nil
+}
+
+func (s *TieredStore) GetNRGBA(key string) (*image.NRGBA, bool, error) {
+	data, exists, err := s.GetBytes(key)
+
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+
+	img, err := decodeNRGBA(data)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return img, true, nil
+}
+
+func (s *TieredStore) Exists(key string) (bool, error) {
+	for _, tier := range s.Tiers {
+		exists, err := tier.Exists(key)
+
+		if err != nil {
+			return false, err
+		}
+
+		if exists {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// TTL returns the remaining time of the value in the fastest tier that contains it, using the time the value expires that is
+// stored alongside the copies in the faster tiers.
+func (s *TieredStore) TTL(key string) (time.Duration, bool, error) {
+	for i, tier := range s.Tiers {
+		if i == len(s.Tiers)-1 {
+			return tier.TTL(key)
+		}
+
+		_, expiresAt, exists, err := s.getTier(i, key)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		if expiresAt.IsZero() {
+			return 0, true, nil
+		}
+
+		if ttl := time.Until(expiresAt); ttl > 0 {
+			return ttl, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+func (s *TieredStore) SetBytes(key string, data []byte, ttl time.Duration) error {
+	var expiresAt time.Time
+
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	for i := range s.Tiers {
+		if err := s.setTier(i, key, data, expiresAt, ttl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getTier returns the value from the tier along with the time it expires, which is the zero time if it does not expire. Values in
+// the faster tiers without a valid header are treated as missing, such as after the order of the tiers changed.
+func (s *TieredStore) getTier(i int, key string) ([]byte, time.Time, bool, error) {
+	if i == len(s.Tiers)-1 {
+		data, ttl, exists, err := s.Tiers[i].GetBytesTTL(key)
+
+		if err != nil || !exists || ttl <= 0 {
+			return data, time.Time{}, exists, err
+		}
+
+		return data, time.Now().Add(ttl), true, nil
+	}
+
+	data, exists, err := s.Tiers[i].GetBytes(key)
+
+	if err != nil || !exists {
+		return data, time.Time{}, exists, err
+	}
+
+	if len(data) < len(tieredHeader)+8 || !bytes.Equal(data[:len(tieredHeader)], tieredHeader) {
+		return nil, time.Time{}, false, nil
+	}
+
+	var expiresAt time.Time
+
+	if value := int64(binary.BigEndian.Uint64(data[len(tieredHeader):])); value > 0 {
+		expiresAt = time.UnixMilli(value)
+	}
+
+	return data[len(tieredHeader)+8:], expiresAt, true, nil
+}
+
+// setTier puts the value into the tier with the TTL, storing the time the value expires alongside it if the tier is one of the
+// faster tiers.
+func (s *TieredStore) setTier(i int, key string, data []byte, expiresAt time.Time, ttl time.Duration) error {
+	if i == len(s.Tiers)-1 {
+		return s.Tiers[i].SetBytes(key, data, ttl)
+	}
+
+	var expiresAtValue int64 = 0
+
+	if !expiresAt.IsZero() {
+		expiresAtValue = expiresAt.UnixMilli()
+	}
+
+	value := make([]byte, len(tieredHeader)+8+len(data))
+
+	copy(value, tieredHeader)
+	binary.BigEndian.PutUint64(value[len(tieredHeader):], uint64(expiresAtValue))
+	copy(value[len(tieredHeader)+8:], data)
+
+	return s.Tiers[i].SetBytes(key, value, ttl)
+}
+
+func (s *TieredStore) Delete(key string) error {
+	for _, tier := range s.Tiers {
+		if err := tier.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TieredStore) Close() error {
+	var result error = nil
+
+	for _, tier := range s.Tiers {
+		if err := tier.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+var _ Store = &TieredStore{}
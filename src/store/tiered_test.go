@@ -0,0 +1,107 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestTieredStore(t *testing.T) *TieredStore {
+	store := &TieredStore{}
+
+	err := store.Initialize(map[string]interface{}{
+		"populate_ttl": "1m",
+		"tiers": []interface{}{
+			map[string]interface{}{"type": "memory", "max_size": "1MB"},
+			map[string]interface{}{"type": "memory", "max_size": "1MB"},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// withinSecond returns true if the duration is at most a second shorter than the expected duration.
+func withinSecond(actual, expected time.Duration) bool {
+	return actual <= expected && actual > expected-time.Second
+}
+
+func TestTieredPopulateTTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		expectedTTL time.Duration
+		copyTTL     time.Duration
+	}{
+		// Copies in the faster tiers are capped by the populate TTL, while the TTL of the value is kept alongside the copy
+		{name: "longer than populate TTL", ttl: time.Hour, expectedTTL: time.Hour, copyTTL: time.Minute},
+		// Copies never outlive the value
+		{name: "shorter than populate TTL", ttl: time.Second * 10, expectedTTL: time.Second * 10, copyTTL: time.Second * 10},
+		{name: "without expiration", ttl: 0, expectedTTL: 0, copyTTL: time.Minute},
+	}
+
+	for _, test := range tests {
+		store := newTestTieredStore(t)
+
+		// The value is only put into the slowest tier, so reading it populates the faster tier
+		if err := store.Tiers[1].SetBytes("key", []byte("value"), test.ttl); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		data, ttl, ok, err := store.GetBytesTTL("key")
+
+		if err != nil || !ok || string(data) != "value" {
+			t.Fatalf("%s: GetBytesTTL returned %q, %t, %v", test.name, data, ok, err)
+		}
+
+		if !withinSecond(ttl, test.expectedTTL) {
+			t.Fatalf("%s: GetBytesTTL returned TTL %v, expected %v", test.name, ttl, test.expectedTTL)
+		}
+
+		copyTTL, ok, err := store.Tiers[0].TTL("key")
+
+		if err != nil || !ok || !withinSecond(copyTTL, test.copyTTL) {
+			t.Fatalf("%s: copy in the faster tier has TTL %v, %t, %v, expected %v", test.name, copyTTL, ok, err, test.copyTTL)
+		}
+
+		// The TTL is now read from the copy in the faster tier, using the expiration stored alongside it
+		if ttl, ok, err = store.TTL("key"); err != nil || !ok || !withinSecond(ttl, test.expectedTTL) {
+			t.Fatalf("%s: TTL returned %v, %t, %v, expected %v", test.name, ttl, ok, err, test.expectedTTL)
+		}
+
+		if data, ttl, ok, err = store.GetBytesTTL("key"); err != nil || !ok || string(data) != "value" || !withinSecond(ttl, test.expectedTTL) {
+			t.Fatalf("%s: GetBytesTTL from the faster tier returned %q, %v, %t, %v", test.name, data, ttl, ok, err)
+		}
+	}
+}
+
+func TestTieredSetBytes(t *testing.T) {
+	store := newTestTieredStore(t)
+
+	if err := store.SetBytes("key", []byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values written through the tiered store are not capped by the populate TTL
+	for i, tier := range store.Tiers {
+		if ttl, ok, err := tier.TTL("key"); err != nil || !ok || !withinSecond(ttl, time.Hour) {
+			t.Fatalf("tier #%d has TTL %v, %t, %v", i+1, ttl, ok, err)
+		}
+	}
+
+	if data, ok, err := store.GetBytes("key"); err != nil || !ok || string(data) != "value" {
+		t.Fatalf("GetBytes returned %q, %t, %v", data, ok, err)
+	}
+
+	if err := store.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := store.Exists("key"); err != nil || ok {
+		t.Fatalf("Exists after delete returned %t, %v", ok, err)
+	}
+}
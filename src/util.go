@@ -7,19 +7,29 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"image"
 	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mineatar-io/api-server/src/render"
+	"github.com/mineatar-io/api-server/src/webp"
 	"github.com/mineatar-io/skin-render"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -30,7 +40,44 @@ var (
 		"jpg",
 		"jpeg",
 		"gif",
+		"webp",
 	}
+	// DefaultQualities is the quality used by each format that supports the `quality` query parameter when it is not provided.
+	// JPEG keeps the default of the standard library encoder so that existing JPEG output is unchanged.
+	DefaultQualities map[string]int = map[string]int{
+		"jpg":  jpeg.DefaultQuality,
+		"jpeg": jpeg.DefaultQuality,
+		"webp": 90,
+	}
+	// UnsupportedFormats maps formats that are recognized but cannot be encoded to the reason sent back to the client.
+	UnsupportedFormats map[string]string = map[string]string{
+		"avif": "AVIF output is not supported, use 'webp' instead",
+	}
+	usernameRegExp *regexp.Regexp = regexp.MustCompile("^[A-Za-z0-9_]{1,16}$")
+	// skinFlight is used to share the result of fetching a skin between concurrent requests for the same skin.
+	skinFlight *singleflight.Group = &singleflight.Group{}
+	// refreshingSkins is the set of cache IDs of the players whose skin is being refreshed in the background by this process.
+	refreshingSkins *sync.Map = &sync.Map{}
+	// textureClient is the HTTP client used to fetch textures from the texture servers of the skin providers, so slow responses
+	// do not hang requests.
+	textureClient *http.Client = &http.Client{Timeout: time.Second * 10}
+	// textureHashRegExp matches the texture hashes used in the URLs of textures, which are at least as long as an MD5 hash.
+	textureHashRegExp *regexp.Regexp = regexp.MustCompile("^[0-9a-f]{32,64}$")
+	// DefaultClassicSkinHash is the texture hash of the default skin of the classic player model.
+	DefaultClassicSkinHash string = "default-classic"
+	// DefaultSlimSkinHash is the texture hash of the default skin of the slim player model.
+	DefaultSlimSkinHash string = "default-slim"
+	// SkinFallbackStale is the fallback of a skin that was served from the cache after it expired, as the skin provider failed.
+	SkinFallbackStale string = "stale"
+	// SkinFallbackDefault is the fallback of a skin that was replaced by the default skin, as the skin provider failed and the
+	// skin of the player is not known.
+	SkinFallbackDefault string = "default"
+	// SkinFallbackNoCape is the fallback of a render that left out the cape of the player, as the skin provider failed.
+	SkinFallbackNoCape string = "no-cape"
+	// ErrInvalidPlayer is returned when resolving a value that is neither a UUID nor a username.
+	ErrInvalidPlayer error = errors.New("invalid UUID or username")
+	// ErrUnknownPlayer is returned when resolving a username that does not belong to any player.
+	ErrUnknownPlayer error = errors.New("unknown player")
 )
 
 // QueryParams is used by most all API routes as options for how the image should be rendered, or how errors should be handled.
@@ -40,6 +87,23 @@ type QueryParams struct {
 	Overlay  bool
 	Format   string
 	Square   bool
+	Yaw      int
+	Pitch    int
+	Pose     render.Pose
+	Cape     bool
+	Elytra   bool
+	Spread   bool
+	Frames   int
+	Delay    int
+	Quality  int
+	Lossless bool
+	Provider string
+}
+
+// RequiresModel returns true if the options can only be rendered using the player model, instead of the flat projections. The
+// cape only requires the model when the player has one, so that players without a cape keep the flat projection.
+func (opts *QueryParams) RequiresModel(cape *image.NRGBA) bool {
+	return opts.Pose != render.PoseStanding || opts.Elytra || (opts.Cape && cape != nil)
 }
 
 // PointerOf returns the value of the first argument as a pointer.
@@ -90,9 +154,128 @@ func ParseUUID(value string) (string, bool) {
 	return value, true
 }
 
+// ParsePlayer parses the UUID or username given by the route parameters and returns the UUID of the player, resolving usernames
+// through the skin provider. If the value is invalid or the player does not exist, an error response is sent and false is
+// returned.
+func ParsePlayer(ctx *fiber.Ctx, value, provider string) (string, bool, error) {
+	uuid, err := ResolvePlayer(value, provider)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPlayer):
+			return "", false, ctx.Status(http.StatusBadRequest).SendString("Invalid UUID or username")
+		case errors.Is(err, ErrUnknownPlayer):
+			return "", false, ctx.Status(http.StatusNotFound).SendString("Unknown player")
+		default:
+			return "", false, err
+		}
+	}
+
+	ctx.Set("X-Player-UUID", uuid)
+
+	return uuid, true, nil
+}
+
+// ResolvePlayer returns the UUID of the player by the UUID or username, resolving usernames through the skin provider, or the
+// providers by priority if it is empty. ErrInvalidPlayer is returned if the value is neither, and ErrUnknownPlayer if no player
+// has the username.
+func ResolvePlayer(value, provider string) (string, error) {
+	if uuid, ok := ParseUUID(value); ok {
+		return uuid, nil
+	}
+
+	if !usernameRegExp.MatchString(value) {
+		return "", ErrInvalidPlayer
+	}
+
+	resolved, err := LookupUUID(value, provider)
+
+	if err != nil {
+		return "", err
+	}
+
+	uuid, ok := ParseUUID(resolved)
+
+	if !ok {
+		return "", ErrUnknownPlayer
+	}
+
+	return uuid, nil
+}
+
+// LookupUUID returns the UUID of the player by their username from the skin provider, or from the first provider by priority
+// that knows the username if the provider is empty, using the cached value if it exists. Errors from providers are skipped over
+// while falling back, and are only returned if no provider answered whether it knows the username.
+func LookupUUID(username, provider string) (string, error) {
+	providers := providerPriority
+
+	if len(provider) > 0 {
+		providers = []string{provider}
+	}
+
+	var (
+		lastErr  error = nil
+		answered bool  = false
+	)
+
+	for _, name := range providers {
+		// Usernames are cached per provider, as the same username can belong to a different player on each of them
+		cacheID := GetPlayerCacheID(username, name)
+
+		uuid, ok, err := GetCachedUUID(cacheID)
+
+		if err != nil {
+			return "", err
+		}
+
+		// Usernames that the provider recently did not know are skipped without asking it again
+		if ok {
+			if len(uuid) < 1 {
+				answered = true
+
+				continue
+			}
+
+			return uuid, nil
+		}
+
+		if uuid, err = skinProviders[name].LookupUUID(username); err != nil {
+			if len(provider) > 0 {
+				return "", err
+			}
+
+			log.Printf("Error: failed to look up %s from provider %s: %v\n", username, name, err)
+
+			lastErr = err
+
+			continue
+		}
+
+		// The username is also cached when the provider does not know it, so repeated requests for it do not reach the provider
+		if err = SetCachedUUID(cacheID, uuid); err != nil {
+			return "", err
+		}
+
+		if len(uuid) < 1 {
+			answered = true
+
+			continue
+		}
+
+		return uuid, nil
+	}
+
+	// The username is unknown rather than failed if any provider said it does not know it
+	if answered {
+		return "", nil
+	}
+
+	return "", lastErr
+}
+
 // FetchImage fetches the image by the URL and returns it as a parsed image.
 func FetchImage(url string) (*image.NRGBA, error) {
-	resp, err := http.Get(url)
+	resp, err := textureClient.Get(url)
 
 	if err != nil {
 		return nil, err
@@ -100,7 +283,16 @@ func FetchImage(url string) (*image.NRGBA, error) {
 
 	defer resp.Body.Close()
 
-	img, format, err := image.Decode(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("texture: unexpected response: %s", resp.Status)
+	}
+
+	return DecodeImage(resp.Body)
+}
+
+// DecodeImage decodes the image from the reader and returns it as an NRGBA image.
+func DecodeImage(r io.Reader) (*image.NRGBA, error) {
+	img, format, err := image.Decode(r)
 
 	if err != nil {
 		return nil, err
@@ -117,104 +309,394 @@ func FetchImage(url string) (*image.NRGBA, error) {
 	return img.(*image.NRGBA), nil
 }
 
-// GetPlayerSkin fetches the skin of the Minecraft player by the UUID.
-func GetPlayerSkin(uuid string) (*image.NRGBA, bool, error) {
+// GetPlayerSkin fetches the skin of the Minecraft player by the UUID from the skin provider, or from the providers by priority
+// if it is empty, also returning if the player has a slim player model and the texture hash of the skin. Cached skins that are
+// stale are returned immediately and refreshed in the background, so only skins that are missing from the cache block. If the
+// skin provider fails, the fallback is either SkinFallbackStale or SkinFallbackDefault depending on the skin that was used in
+// place of the skin of the player, and is otherwise empty.
+func GetPlayerSkin(uuid, provider string) (*image.NRGBA, bool, string, string, error) {
+	// Concurrent requests for the same skin within this process share a single result, and only one of them uses the cache and
+	// the lock shared with other processes
+	result, err, _ := skinFlight.Do(fmt.Sprintf("skin-lock:%s", GetPlayerCacheID(uuid, provider)), func() (interface{}, error) {
+		rawSkin, slim, textureHash, fallback, err := getPlayerSkin(uuid, provider)
+
+		return &playerSkinResult{rawSkin, slim, textureHash, fallback}, err
+	})
+
+	if err != nil {
+		return nil, false, "", "", err
+	}
+
+	playerSkin := result.(*playerSkinResult)
+
+	return playerSkin.Image, playerSkin.Slim, playerSkin.TextureHash, playerSkin.Fallback, nil
+}
+
+// playerSkinResult is the result of GetPlayerSkin shared by concurrent requests for the same skin.
+type playerSkinResult struct {
+	Image       *image.NRGBA
+	Slim        bool
+	TextureHash string
+	Fallback    string
+}
+
+// getPlayerSkin returns the skin of the player the same as GetPlayerSkin, without sharing the result with concurrent requests.
+func getPlayerSkin(uuid, provider string) (*image.NRGBA, bool, string, string, error) {
+	// Get skin from cache, and return if it exists
+	if rawSkin, slim, textureHash, err := getCachedPlayerSkin(uuid, provider); err != nil || rawSkin != nil {
+		return rawSkin, slim, textureHash, "", err
+	}
+
 	if config.Cache.EnableLocks {
-		mutex := r.NewMutex(fmt.Sprintf("skin-lock:%s", uuid))
+		mutex := r.NewMutex(fmt.Sprintf("skin-lock:%s", GetPlayerCacheID(uuid, provider)))
 		mutex.Lock()
 
 		defer mutex.Unlock()
+
+		// Another process may have put the skin into cache while this one was waiting for the lock
+		if rawSkin, slim, textureHash, err := getCachedPlayerSkin(uuid, provider); err != nil || rawSkin != nil {
+			return rawSkin, slim, textureHash, "", err
+		}
 	}
 
-	// Get skin from cache, and return if it exists
-	if config.Cache.SkinCacheDuration != nil {
-		rawSkin, slim, err := GetCachedSkin(uuid)
+	return fetchPlayerSkin(uuid, provider)
+}
+
+// getCachedPlayerSkin returns the skin of the player from the cache, or nil if it is not cached. If the skin is stale, it is
+// still returned and a refresh is started in the background.
+func getCachedPlayerSkin(uuid, provider string) (*image.NRGBA, bool, string, error) {
+	if config.Cache.SkinCacheDuration == nil {
+		return nil, false, "", nil
+	}
+
+	cacheID := GetPlayerCacheID(uuid, provider)
+
+	rawSkin, slim, textureHash, err := GetCachedSkin(cacheID)
+
+	if err != nil || rawSkin == nil {
+		return nil, false, "", err
+	}
+
+	stale, err := IsCachedSkinStale(cacheID)
+
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	if stale {
+		go refreshPlayerSkin(uuid, provider)
+	}
+
+	return rawSkin, slim, textureHash, nil
+}
+
+// refreshPlayerSkin fetches the skin of the player again to replace the stale skin in the cache. Only one refresh of a player
+// runs at a time within the process, and across processes when locks are enabled, while the others keep returning the stale
+// skin.
+func refreshPlayerSkin(uuid, provider string) {
+	cacheID := GetPlayerCacheID(uuid, provider)
+
+	if _, running := refreshingSkins.LoadOrStore(cacheID, true); running {
+		return
+	}
+
+	defer refreshingSkins.Delete(cacheID)
+
+	if config.Cache.EnableLocks {
+		mutex := r.NewMutex(fmt.Sprintf("skin-lock:%s", cacheID))
+
+		ok, err := mutex.TryLock()
 
 		if err != nil {
-			return nil, false, err
+			log.Printf("Error: failed to lock skin of %s for refresh: %v\n", cacheID, err)
+
+			return
 		}
 
-		if rawSkin != nil {
-			return rawSkin, slim, nil
+		// Another process is already fetching the skin
+		if !ok {
+			return
 		}
+
+		defer mutex.Unlock()
 	}
 
+	// The skin may have been refreshed by another process since it was found to be stale
+	if stale, err := IsCachedSkinStale(cacheID); err != nil || !stale {
+		return
+	}
+
+	if _, _, _, _, err := fetchPlayerSkin(uuid, provider); err != nil {
+		log.Printf("Error: failed to refresh skin of %s: %v\n", cacheID, err)
+	}
+}
+
+// fetchPlayerSkin fetches the skin of the player from the skin providers without using the cache, and puts it into the cache.
+func fetchPlayerSkin(uuid, provider string) (*image.NRGBA, bool, string, string, error) {
+	cacheID := GetPlayerCacheID(uuid, provider)
+
 	var (
-		err              error             = nil
-		skinImage        *image.NRGBA      = nil
-		rawSkin          []byte            = nil
-		isSlim           bool              = skin.IsSlimFromUUID(uuid)
-		profile          *MinecraftProfile = nil
-		rawTextures      string            = ""
-		texturesProperty *DecodedTextures  = nil
+		err         error           = nil
+		skinImage   *image.NRGBA    = nil
+		rawSkin     []byte          = nil
+		textureHash string          = ""
+		isSlim      bool            = skin.IsSlimFromUUID(uuid)
+		textures    *PlayerTextures = nil
 	)
 
-	// Get the textures metadata from Mojang about the Minecraft player
+	// Get the location of the textures of the Minecraft player from the skin providers
 	{
-		if profile, err = GetMinecraftProfile(uuid); err != nil {
-			return skin.GetDefaultSkin(isSlim), true, nil
-		}
-
-		if profile == nil {
-			return skin.GetDefaultSkin(isSlim), isSlim, nil
+		if textures, err = GetPlayerTextures(uuid, provider); err != nil {
+			return getFallbackSkin(cacheID, isSlim)
 		}
 
-		if err = r.Set(fmt.Sprintf("unique:%s", profile.UUID), "0", 0); err != nil {
-			return nil, false, err
-		}
-	}
+		// Put the cape URL into cache as well since the textures have already been fetched, which saves a provider request when the
+		// cape is fetched. Only the URL is cached so that responses do not wait on a texture most requests never use.
+		if config.Cache.SkinCacheDuration != nil {
+			capeURL := ""
 
-	// Locate the skin information within the Minecraft profile properties
-	{
-		for _, property := range profile.Properties {
-			if property.Name != "textures" {
-				continue
+			if textures != nil {
+				capeURL = textures.CapeURL
 			}
 
-			rawTextures = property.Value
-		}
-
-		if len(rawTextures) < 1 {
-			return skin.GetDefaultSkin(isSlim), isSlim, nil
+			if err = SetCachedCapeURL(cacheID, capeURL); err != nil {
+				return nil, false, "", "", err
+			}
 		}
-	}
 
-	// Decode the raw textures value returned from the player's properties
-	{
-		if texturesProperty, err = DecodeTexturesValue(rawTextures); err != nil {
-			return nil, false, err
+		if textures == nil {
+			return skin.GetDefaultSkin(isSlim), isSlim, GetDefaultSkinHash(isSlim), "", nil
 		}
 
-		if len(texturesProperty.Textures.Skin.URL) < 1 {
-			return skin.GetDefaultSkin(isSlim), isSlim, nil
+		if len(textures.SkinURL) < 1 {
+			return skin.GetDefaultSkin(isSlim), isSlim, GetDefaultSkinHash(isSlim), "", nil
 		}
 
-		isSlim = texturesProperty.Textures.Skin.Metadata.Model == "slim"
+		isSlim = textures.Slim
+		textureHash = textures.SkinHash
 	}
 
-	// Fetch the raw skin image from the Mojang API
+	// Fetch the raw skin image from the texture server of the provider
 	{
-		if skinImage, err = FetchImage(texturesProperty.Textures.Skin.URL); err != nil {
+		if skinImage, err = FetchImage(textures.SkinURL); err != nil {
 			if !errors.Is(err, image.ErrFormat) {
-				return nil, false, err
+				return getFallbackSkin(cacheID, isSlim)
 			}
 
 			skinImage = skin.GetDefaultSkin(isSlim)
+			textureHash = GetDefaultSkinHash(isSlim)
+		}
+
+		// Normalize the skin the same as the vanilla client, and use the default skin in place of skins with an invalid size
+		if skinImage, err = NormalizeSkin(skinImage); err != nil {
+			if !errors.Is(err, ErrInvalidSkin) {
+				return nil, false, "", "", err
+			}
+
+			skinImage = skin.GetDefaultSkin(isSlim)
+			textureHash = GetDefaultSkinHash(isSlim)
 		}
 
 		if rawSkin, err = EncodePNG(skinImage); err != nil {
-			return nil, false, err
+			return nil, false, "", "", err
+		}
+
+		// Skins without a texture hash, such as those of template providers, are identified by the hash of the normalized skin
+		if len(textureHash) < 1 {
+			digest := sha256.Sum256(rawSkin)
+
+			textureHash = hex.EncodeToString(digest[:])
 		}
 	}
 
 	// Put the skin into cache so it can be used for future requests
 	if config.Cache.SkinCacheDuration != nil {
-		if err = SetCachedSkin(uuid, rawSkin, isSlim); err != nil {
-			return nil, false, err
+		if err = SetCachedSkin(cacheID, textureHash, rawSkin, isSlim); err != nil {
+			return nil, false, "", "", err
 		}
 	}
 
-	return skinImage, isSlim, nil
+	return skinImage, isSlim, textureHash, "", nil
+}
+
+// getFallbackSkin returns the skin used in place of the skin of a player when the skin provider fails, which is the last known
+// skin of the player if it is still retained, or otherwise the default skin. Neither is put into the cache, so the skin is
+// fetched again by the next request.
+func getFallbackSkin(cacheID string, isSlim bool) (*image.NRGBA, bool, string, string, error) {
+	rawSkin, slim, textureHash, err := GetFallbackSkin(cacheID)
+
+	if err != nil {
+		return nil, false, "", "", err
+	}
+
+	if rawSkin != nil {
+		return rawSkin, slim, textureHash, SkinFallbackStale, nil
+	}
+
+	return skin.GetDefaultSkin(isSlim), isSlim, GetDefaultSkinHash(isSlim), SkinFallbackDefault, nil
+}
+
+// SetSkinFallbackHeaders marks a response that used a fallback skin because the skin provider failed, and prevents clients from
+// caching it so that the skin of the player is used once the skin provider recovers.
+func SetSkinFallbackHeaders(ctx *fiber.Ctx, fallback string) {
+	if len(fallback) < 1 {
+		return
+	}
+
+	ctx.Set("X-Skin-Fallback", fallback)
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+}
+
+// GetTextureHash returns the texture hash from the last path segment of a texture URL, such as the URLs of textures.minecraft.net,
+// or an empty string if the URL does not end with one.
+func GetTextureHash(textureURL string) string {
+	parsedURL, err := url.Parse(textureURL)
+
+	if err != nil {
+		return ""
+	}
+
+	textureHash := strings.ToLower(path.Base(parsedURL.Path))
+
+	// Some texture servers, such as Ely.by, include the file extension after the hash
+	if index := strings.LastIndex(textureHash, "."); index >= 0 {
+		textureHash = textureHash[:index]
+	}
+
+	if !textureHashRegExp.MatchString(textureHash) {
+		return ""
+	}
+
+	return textureHash
+}
+
+// GetDefaultSkinHash returns the texture hash used for the default skin of a player model, which is shared by every player
+// without a skin.
+func GetDefaultSkinHash(isSlim bool) string {
+	if isSlim {
+		return DefaultSlimSkinHash
+	}
+
+	return DefaultClassicSkinHash
+}
+
+// GetPlayerCape fetches the cape of the Minecraft player by the UUID from the skin provider, or from the providers by priority if
+// it is empty, returning nil if the player does not have a cape. An error is returned if the skin providers failed, as it is then
+// unknown whether the player has a cape.
+func GetPlayerCape(uuid, provider string) (*image.NRGBA, error) {
+	cacheID := GetPlayerCacheID(uuid, provider)
+
+	// Get cape from cache, and return if it exists
+	if cape, ok, err := getCachedPlayerCape(cacheID); err != nil || ok {
+		return cape, err
+	}
+
+	if config.Cache.EnableLocks {
+		mutex := r.NewMutex(fmt.Sprintf("cape-lock:%s", cacheID))
+		mutex.Lock()
+
+		defer mutex.Unlock()
+
+		// Another process may have put the cape into cache while this one was waiting for the lock
+		if cape, ok, err := getCachedPlayerCape(cacheID); err != nil || ok {
+			return cape, err
+		}
+	}
+
+	return fetchPlayerCape(uuid, provider)
+}
+
+// getCachedPlayerCape returns the cape of the player from the cache, and whether it was cached.
+func getCachedPlayerCape(cacheID string) (*image.NRGBA, bool, error) {
+	if config.Cache.SkinCacheDuration == nil {
+		return nil, false, nil
+	}
+
+	return GetCachedCape(cacheID)
+}
+
+// fetchPlayerCape fetches the cape of the player without using the cache, and puts it into the cache. The cape URL cached
+// alongside the skin is used if it exists, so the skin providers are only requested when the skin is not cached either.
+func fetchPlayerCape(uuid, provider string) (*image.NRGBA, error) {
+	var (
+		cacheID  string          = GetPlayerCacheID(uuid, provider)
+		textures *PlayerTextures = nil
+	)
+
+	capeURL, ok, err := getCachedCapeURL(cacheID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		textures = &PlayerTextures{CapeURL: capeURL}
+	} else if textures, err = GetPlayerTextures(uuid, provider); err != nil {
+		return nil, err
+	}
+
+	cape, err := FetchCape(textures)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Cache.SkinCacheDuration != nil {
+		var rawCape []byte = nil
+
+		if cape != nil {
+			if rawCape, err = EncodePNG(cape); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = SetCachedCape(cacheID, rawCape); err != nil {
+			return nil, err
+		}
+	}
+
+	return cape, nil
+}
+
+// getCachedCapeURL returns the cape URL of the player from the cache, and whether it was cached.
+func getCachedCapeURL(cacheID string) (string, bool, error) {
+	if config.Cache.SkinCacheDuration == nil {
+		return "", false, nil
+	}
+
+	return GetCachedCapeURL(cacheID)
+}
+
+// GetRenderCape returns the cape used by a render of the player, or nil if the render does not use a cape. The cape is left out
+// when the skin is a fallback or the skin provider failed to provide the cape, which is then returned as the fallback of the
+// render alongside the fallback of the skin. Renders with a fallback are not cached, as they differ from the actual render.
+func GetRenderCape(uuid, fallback string, opts *QueryParams) (*image.NRGBA, string) {
+	if !opts.Cape && !opts.Elytra {
+		return nil, fallback
+	}
+
+	if len(fallback) > 0 {
+		return nil, fallback
+	}
+
+	cape, err := GetPlayerCape(uuid, opts.Provider)
+
+	if err != nil {
+		log.Printf("Error: failed to fetch the cape of %s, rendering without a cape: %v\n", uuid, err)
+
+		return nil, SkinFallbackNoCape
+	}
+
+	return cape, ""
+}
+
+// FetchCape fetches the cape image from the textures of a player, returning nil if the player does not have a cape.
+func FetchCape(textures *PlayerTextures) (*image.NRGBA, error) {
+	if textures == nil || len(textures.CapeURL) < 1 {
+		return nil, nil
+	}
+
+	return FetchImage(textures.CapeURL)
 }
 
 // EncodePNG encodes the image into PNG format and returns the data as a byte array.
@@ -243,7 +725,7 @@ func EncodeImage(img image.Image, opts *QueryParams) ([]byte, error) {
 		}
 	case "jpg", "jpeg":
 		{
-			if err := jpeg.Encode(buf, img, nil); err != nil {
+			if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
 				return nil, err
 			}
 
@@ -255,6 +737,14 @@ func EncodeImage(img image.Image, opts *QueryParams) ([]byte, error) {
 				return nil, err
 			}
 
+			break
+		}
+	case "webp":
+		{
+			if err := webp.Encode(buf, img, &webp.Options{Lossless: opts.Lossless, Quality: opts.Quality}); err != nil {
+				return nil, err
+			}
+
 			break
 		}
 	default:
@@ -266,21 +756,454 @@ func EncodeImage(img image.Image, opts *QueryParams) ([]byte, error) {
 
 // ParseQueryParams parses the query parameters from the request and returns a QueryParams struct, using default values from the provided configuration.
 func ParseQueryParams(ctx *fiber.Ctx, route RouteConfig) *QueryParams {
-	format := ctx.Query("format", route.DefaultFormat)
+	return ParseQueryParamsWithFormats(ctx, route, AllowedFormats)
+}
 
-	if !Contains(AllowedFormats, format) {
-		ctx.Status(http.StatusBadRequest).SendString("Invalid 'format' query parameter")
+// ParseQueryParamsWithFormats parses the query parameters from the request the same as ParseQueryParams, but only allows the
+// output format to be one of the provided formats.
+func ParseQueryParamsWithFormats(ctx *fiber.Ctx, route RouteConfig, formats []string) *QueryParams {
+	format, ok := ParseFormat(ctx, route.DefaultFormat, formats)
 
+	if !ok {
 		return nil
 	}
 
-	return &QueryParams{
+	provider, ok := ParseProvider(ctx)
+
+	if !ok {
+		return nil
+	}
+
+	opts := &QueryParams{
 		Scale:    Clamp(ctx.QueryInt("scale", route.DefaultScale), route.MinScale, route.MaxScale),
 		Download: ctx.QueryBool("download", route.DefaultDownload),
 		Overlay:  ctx.QueryBool("overlay", route.DefaultOverlay),
-		Format:   ctx.Query("format", route.DefaultFormat),
+		Format:   format,
 		Square:   ctx.QueryBool("square", route.DefaultSquare),
+		Provider: provider,
+	}
+
+	// The quality is only set for formats that use it so that other formats share the same cache key regardless of the value
+	if defaultQuality, ok := DefaultQualities[opts.Format]; ok {
+		opts.Quality = Clamp(ctx.QueryInt("quality", defaultQuality), 1, 100)
+	}
+
+	// WebP images are lossless unless a quality is requested, as the flat colors of skins compress better without loss
+	if opts.Format == "webp" {
+		opts.Lossless = ctx.QueryBool("lossless", len(ctx.Query("quality")) < 1)
+	}
+
+	return opts
+}
+
+// ParseFormat returns the output format of the request, in order of the `format` query parameter, the extension of the
+// route param (such as "<uuid>.webp"), the best match of the Accept header, and finally the default format. It returns false
+// if the query parameter or extension is not one of the formats, and an error response is sent.
+func ParseFormat(ctx *fiber.Ctx, defaultFormat string, formats []string) (string, bool) {
+	if format := strings.ToLower(ctx.Query("format")); len(format) > 0 {
+		if reason, ok := UnsupportedFormats[format]; ok {
+			ctx.Status(http.StatusBadRequest).SendString(reason)
+
+			return "", false
+		}
+
+		if !Contains(formats, format) {
+			ctx.Status(http.StatusBadRequest).SendString("Invalid 'format' query parameter")
+
+			return "", false
+		}
+
+		return format, true
+	}
+
+	if _, extension, ok := strings.Cut(ctx.Params("uuid"), "."); ok {
+		extension = strings.ToLower(extension)
+
+		if reason, ok := UnsupportedFormats[extension]; ok {
+			ctx.Status(http.StatusBadRequest).SendString(reason)
+
+			return "", false
+		}
+
+		if !Contains(formats, extension) {
+			ctx.Status(http.StatusBadRequest).SendString("Invalid file extension")
+
+			return "", false
+		}
+
+		return extension, true
+	}
+
+	// The response now depends on the Accept header, so shared caches must store each variant separately
+	ctx.Vary(fiber.HeaderAccept)
+
+	// The default format is offered first so that wildcards such as "*/*" and "image/*" keep returning it
+	offers := make([]string, 0, len(formats)+1)
+
+	if Contains(formats, defaultFormat) {
+		offers = append(offers, defaultFormat)
+	}
+
+	offers = append(offers, formats...)
+
+	if format := ctx.Accepts(offers...); len(format) > 0 {
+		return format, true
+	}
+
+	return defaultFormat, true
+}
+
+// ParseProvider returns the name of the skin provider selected by the `provider` route prefix or query parameter, or an empty
+// string if the providers should be used by priority. It returns false if the provider is not configured, and an error response
+// is sent.
+func ParseProvider(ctx *fiber.Ctx) (string, bool) {
+	provider := ctx.Params("provider", ctx.Query("provider"))
+
+	if len(provider) < 1 {
+		return "", true
+	}
+
+	if _, ok := skinProviders[provider]; !ok {
+		ctx.Status(http.StatusBadRequest).SendString("Unknown skin provider")
+
+		return "", false
+	}
+
+	return provider, true
+}
+
+// ParseCameraParams parses the camera angle query parameters from the request into the existing QueryParams, using default values from the provided configuration.
+func ParseCameraParams(ctx *fiber.Ctx, route CameraRouteConfig, opts *QueryParams) {
+	// Normalize the yaw into the 0-359 range so equivalent angles share the same cache key
+	opts.Yaw = ((ctx.QueryInt("yaw", route.DefaultYaw) % 360) + 360) % 360
+	opts.Pitch = Clamp(ctx.QueryInt("pitch", route.DefaultPitch), -90, 90)
+}
+
+// ParsePoseParams parses the pose query parameters from the request into the existing QueryParams, starting from the named
+// pose in the `pose` query parameter and allowing each rotation to be overridden. Any pose other than standing switches the
+// flat body routes to the player model, see modelCameraAngles. It returns false if the pose is invalid, and an error response
+// is sent.
+func ParsePoseParams(ctx *fiber.Ctx, opts *QueryParams) bool {
+	pose, ok := render.Poses[strings.ToLower(ctx.Query("pose", "standing"))]
+
+	if !ok {
+		ctx.Status(http.StatusBadRequest).SendString("Invalid 'pose' query parameter")
+
+		return false
+	}
+
+	rotations := []struct {
+		Key   string
+		Value *float64
+	}{
+		{"head_yaw", &pose.HeadYaw},
+		{"head_pitch", &pose.HeadPitch},
+		{"right_arm_pitch", &pose.RightArmPitch},
+		{"right_arm_roll", &pose.RightArmRoll},
+		{"left_arm_pitch", &pose.LeftArmPitch},
+		{"left_arm_roll", &pose.LeftArmRoll},
+		{"right_leg_pitch", &pose.RightLegPitch},
+		{"right_leg_roll", &pose.RightLegRoll},
+		{"left_leg_pitch", &pose.LeftLegPitch},
+		{"left_leg_roll", &pose.LeftLegRoll},
+	}
+
+	for _, rotation := range rotations {
+		// Rotations are limited to whole degrees within a single turn so that equivalent poses share the same cache key
+		*rotation.Value = float64(Clamp(ctx.QueryInt(rotation.Key, int(*rotation.Value)), -180, 180))
+	}
+
+	opts.Pose = pose
+
+	return true
+}
+
+// ParseAttachmentParams parses the cape and elytra query parameters from the request into the existing QueryParams.
+func ParseAttachmentParams(ctx *fiber.Ctx, opts *QueryParams) {
+	opts.Cape = ctx.QueryBool("cape", false)
+	opts.Elytra = ctx.QueryBool("elytra", false)
+	opts.Spread = opts.Elytra && ctx.QueryBool("elytra_spread", false)
+}
+
+// ParseAnimationParams parses the animation query parameters from the request into the existing QueryParams, using default values
+// from the provided configuration.
+func ParseAnimationParams(ctx *fiber.Ctx, route TurntableRouteConfig, opts *QueryParams) {
+	opts.Frames = Clamp(ctx.QueryInt("frames", route.DefaultFrames), 1, route.MaxFrames)
+	opts.Delay = Clamp(ctx.QueryInt("delay", route.DefaultDelay), route.MinDelay, route.MaxDelay)
+}
+
+// HandleConditionalRequest sets the ETag, Last-Modified and Cache-Control headers of a response using the textures of the
+// player. The ETag is computed from the result cache key and the textures, so it is known before anything is rendered, and the
+// cape is included when the render uses it. Responses that used a fallback are never cached publicly, including 304
+// responses. It returns true if the copy held by the client is still fresh, in which case a 304 response is sent.
+func HandleConditionalRequest(ctx *fiber.Ctx, resultKey, uuid string, rawSkin, rawCape *image.NRGBA, fallback string, opts *QueryParams) (bool, error) {
+	var (
+		err          error
+		lastModified time.Time
+		cachedAt     time.Time
+		digest       hash.Hash = sha256.New()
+		cacheID      string    = GetPlayerCacheID(uuid, opts.Provider)
+	)
+
+	digest.Write([]byte(resultKey))
+
+	if rawSkin != nil {
+		digest.Write(rawSkin.Pix)
+
+		if lastModified, err = GetCachedSkinTime(cacheID); err != nil {
+			return false, err
+		}
+	}
+
+	if rawCape != nil {
+		digest.Write(rawCape.Pix)
+
+		if cachedAt, err = GetCachedCapeTime(cacheID); err != nil {
+			return false, err
+		}
+
+		if cachedAt.After(lastModified) {
+			lastModified = cachedAt
+		}
+	}
+
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(digest.Sum(nil)))
+
+	ctx.Set(fiber.HeaderETag, etag)
+	ctx.Set(fiber.HeaderCacheControl, GetCacheControl())
+	SetSkinFallbackHeaders(ctx, fallback)
+
+	if !lastModified.IsZero() {
+		ctx.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if !isFresh(ctx, etag, lastModified) {
+		return false, nil
+	}
+
+	return true, ctx.SendStatus(http.StatusNotModified)
+}
+
+// GetCacheControl returns the value of the Cache-Control header sent with images, which allows clients to cache them for as long
+// as renders are cached unless a different max age is configured.
+func GetCacheControl() string {
+	maxAge := config.Cache.CacheControlMaxAge
+
+	if maxAge == nil {
+		maxAge = config.Cache.RenderCacheDuration
+	}
+
+	if maxAge == nil {
+		return "no-cache"
+	}
+
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge.Seconds()))
+}
+
+// SetRenderCacheHeaders sets the X-Cache-Time-Remaining and Age headers of a render response from the TTL of the cached result.
+// Results are always cached for the render cache duration, so the age is derived from it.
+func SetRenderCacheHeaders(ctx *fiber.Ctx, resultKey string) error {
+	ttl, ok, err := GetCachedRenderResultTTL(resultKey)
+
+	if err != nil || !ok {
+		return err
+	}
+
+	setCacheTimeHeaders(ctx, ttl, *config.Cache.RenderCacheDuration-ttl)
+
+	return nil
+}
+
+// SetSkinCacheHeaders sets the X-Cache-Time-Remaining and Age headers of a skin response from the time the skin was put into the
+// cache, as the TTL of the skin is extended by the stale and fallback durations.
+func SetSkinCacheHeaders(ctx *fiber.Ctx, uuid string, opts *QueryParams) error {
+	if config.Cache.SkinCacheDuration == nil {
+		return nil
+	}
+
+	cachedAt, err := GetCachedSkinTime(GetPlayerCacheID(uuid, opts.Provider))
+
+	if err != nil || cachedAt.IsZero() {
+		return err
+	}
+
+	// The remaining time is until the skin becomes stale, so stale skins that are being refreshed do not send either header
+	age := time.Since(cachedAt)
+
+	setCacheTimeHeaders(ctx, *config.Cache.SkinCacheDuration-age, age)
+
+	return nil
+}
+
+// setCacheTimeHeaders sets the remaining time and age in seconds of a cached value. Values without an expiration have no
+// meaningful age, so neither header is set.
+func setCacheTimeHeaders(ctx *fiber.Ctx, ttl, age time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	if age < 0 {
+		age = 0
+	}
+
+	ctx.Set("X-Cache-Time-Remaining", strconv.FormatInt(int64(ttl.Seconds()), 10))
+	ctx.Set(fiber.HeaderAge, strconv.FormatInt(int64(age.Seconds()), 10))
+}
+
+// isFresh returns true if the conditional headers of the request match the ETag and modification time of the response. The
+// If-Modified-Since header is ignored when If-None-Match is present, as described by RFC 7232.
+func isFresh(ctx *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if ctx.Method() != fiber.MethodGet && ctx.Method() != fiber.MethodHead {
+		return false
+	}
+
+	if noneMatch := ctx.Get(fiber.HeaderIfNoneMatch); len(noneMatch) > 0 {
+		for _, value := range strings.Split(noneMatch, ",") {
+			// Weak comparison is used, so "W/" prefixes added by proxies that modify the encoding still match
+			value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+
+			if value == "*" || value == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if modifiedSince := ctx.Get(fiber.HeaderIfModifiedSince); len(modifiedSince) > 0 && !lastModified.IsZero() {
+		value, err := http.ParseTime(modifiedSince)
+
+		return err == nil && !lastModified.Truncate(time.Second).After(value)
+	}
+
+	return false
+}
+
+// ParseRenderTypeParams parses the render type from the `type` route parameter and the render options from the query
+// parameters, using the same parameters and configuration as the individual route of the render type. If the render type is
+// unknown or any query parameter is invalid, an error response is sent and nil options are returned.
+func ParseRenderTypeParams(ctx *fiber.Ctx) (string, *QueryParams) {
+	renderType := ctx.Params("type")
+
+	// Animated renders are only available from their individual route
+	if renderType == RenderTypeTurntable {
+		ctx.Status(http.StatusNotFound).SendString("Unknown render type")
+
+		return "", nil
 	}
+
+	opts := ParseRenderParams(ctx, renderType)
+
+	if opts == nil {
+		return "", nil
+	}
+
+	return renderType, opts
+}
+
+// ParseRenderParams parses the render options of the render type from the query parameters, using the configuration of the
+// individual route of the render type. If the render type is unknown or any query parameter is invalid, an error response is
+// sent and nil is returned.
+func ParseRenderParams(ctx *fiber.Ctx, renderType string) *QueryParams {
+	var opts *QueryParams = nil
+
+	switch renderType {
+	case RenderTypeFace:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.Face)
+
+			break
+		}
+	case RenderTypeHead:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.Head)
+
+			break
+		}
+	case RenderTypeFullBody:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.FullBody)
+
+			break
+		}
+	case RenderTypeFrontBody:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.FrontBody)
+
+			break
+		}
+	case RenderTypeBackBody:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.BackBody)
+
+			break
+		}
+	case RenderTypeLeftBody:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.LeftBody)
+
+			break
+		}
+	case RenderTypeRightBody:
+		{
+			opts = ParseQueryParams(ctx, config.Routes.RightBody)
+
+			break
+		}
+	case RenderTypeBody3D:
+		{
+			if opts = ParseQueryParams(ctx, config.Routes.Body3D.RouteConfig); opts != nil {
+				ParseCameraParams(ctx, config.Routes.Body3D, opts)
+			}
+
+			break
+		}
+	case RenderTypeHead3D:
+		{
+			if opts = ParseQueryParams(ctx, config.Routes.Head3D.RouteConfig); opts != nil {
+				ParseCameraParams(ctx, config.Routes.Head3D, opts)
+			}
+
+			break
+		}
+	case RenderTypeTurntable:
+		{
+			if opts = ParseQueryParamsWithFormats(ctx, config.Routes.Turntable.RouteConfig, AnimatedFormats); opts != nil {
+				ParseAnimationParams(ctx, config.Routes.Turntable, opts)
+				ParseCameraParams(ctx, config.Routes.Turntable.CameraRouteConfig, opts)
+			}
+
+			break
+		}
+	default:
+		{
+			ctx.Status(http.StatusNotFound).SendString("Unknown render type")
+
+			return nil
+		}
+	}
+
+	if opts == nil {
+		return nil
+	}
+
+	// The pose and attachments are only supported by the body renders
+	switch renderType {
+	case RenderTypeFullBody, RenderTypeFrontBody, RenderTypeBackBody, RenderTypeLeftBody, RenderTypeRightBody, RenderTypeBody3D, RenderTypeTurntable:
+		{
+			if !ParsePoseParams(ctx, opts) {
+				return nil
+			}
+
+			if renderType != RenderTypeFrontBody {
+				ParseAttachmentParams(ctx, opts)
+			}
+
+			break
+		}
+	}
+
+	return opts
 }
 
 // GetInstanceID returns the INSTANCE_ID environment variable parsed as an unsigned 16-bit integer.
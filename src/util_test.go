@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseFormat(t *testing.T) {
+	testApp := fiber.New()
+
+	testApp.Get("/:uuid", func(ctx *fiber.Ctx) error {
+		format, ok := ParseFormat(ctx, "png", AllowedFormats)
+
+		if !ok {
+			return nil
+		}
+
+		return ctx.SendString(format)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		status int
+		format string
+		vary   bool
+	}{
+		{name: "default", path: "/player", status: http.StatusOK, format: "png", vary: true},
+		{name: "query parameter", path: "/player?format=webp", status: http.StatusOK, format: "webp"},
+		{name: "uppercase query parameter", path: "/player?format=JPG", status: http.StatusOK, format: "jpg"},
+		{name: "query parameter before extension", path: "/player.gif?format=webp", status: http.StatusOK, format: "webp"},
+		{name: "query parameter before accept", path: "/player?format=jpg", accept: "image/webp", status: http.StatusOK, format: "jpg"},
+		{name: "invalid query parameter", path: "/player?format=bmp", status: http.StatusBadRequest},
+		{name: "unsupported query parameter", path: "/player?format=avif", status: http.StatusBadRequest},
+		{name: "extension", path: "/player.webp", status: http.StatusOK, format: "webp"},
+		{name: "uppercase extension", path: "/player.JPEG", status: http.StatusOK, format: "jpeg"},
+		{name: "invalid extension", path: "/player.bmp", status: http.StatusBadRequest},
+		{name: "unsupported extension", path: "/player.avif", status: http.StatusBadRequest},
+		{name: "accept", path: "/player", accept: "image/webp,image/*;q=0.8", status: http.StatusOK, format: "webp", vary: true},
+		{name: "accept wildcard", path: "/player", accept: "*/*", status: http.StatusOK, format: "png", vary: true},
+		{name: "accept image wildcard", path: "/player", accept: "image/*", status: http.StatusOK, format: "png", vary: true},
+		{name: "accept unknown", path: "/player", accept: "text/html", status: http.StatusOK, format: "png", vary: true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+
+		if len(test.accept) > 0 {
+			req.Header.Set(fiber.HeaderAccept, test.accept)
+		}
+
+		resp, err := testApp.Test(req)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Fatalf("%s: status %d, expected %d", test.name, resp.StatusCode, test.status)
+		}
+
+		if test.status == http.StatusOK && string(body) != test.format {
+			t.Fatalf("%s: format %q, expected %q", test.name, body, test.format)
+		}
+
+		if vary := resp.Header.Get(fiber.HeaderVary) == fiber.HeaderAccept; vary != test.vary {
+			t.Fatalf("%s: Vary header %q", test.name, resp.Header.Get(fiber.HeaderVary))
+		}
+	}
+}
+
+func TestIsFresh(t *testing.T) {
+	var (
+		testApp      *fiber.App = fiber.New()
+		etag         string     = `"abc"`
+		lastModified time.Time  = time.Date(2024, time.January, 2, 3, 4, 5, int(time.Millisecond*500), time.UTC)
+	)
+
+	// The result is sent in a header, as responses to HEAD requests do not have a body
+	testApp.All("/", func(ctx *fiber.Ctx) error {
+		ctx.Set("X-Fresh", strconv.FormatBool(isFresh(ctx, etag, lastModified)))
+
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	testApp.All("/unknown", func(ctx *fiber.Ctx) error {
+		ctx.Set("X-Fresh", strconv.FormatBool(isFresh(ctx, etag, time.Time{})))
+
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		noneMatch     string
+		modifiedSince string
+		expected      bool
+	}{
+		{name: "no conditional headers", expected: false},
+		{name: "matching ETag", noneMatch: `"abc"`, expected: true},
+		{name: "weak matching ETag", noneMatch: `W/"abc"`, expected: true},
+		{name: "ETag list", noneMatch: `"xyz", "abc"`, expected: true},
+		{name: "ETag wildcard", noneMatch: "*", expected: true},
+		{name: "different ETag", noneMatch: `"xyz"`, expected: false},
+		{name: "ETag over modification time", noneMatch: `"xyz"`, modifiedSince: "Tue, 02 Jan 2024 03:04:05 GMT", expected: false},
+		{name: "same modification time", modifiedSince: "Tue, 02 Jan 2024 03:04:05 GMT", expected: true},
+		{name: "later modification time", modifiedSince: "Wed, 03 Jan 2024 00:00:00 GMT", expected: true},
+		{name: "earlier modification time", modifiedSince: "Tue, 02 Jan 2024 03:04:04 GMT", expected: false},
+		{name: "invalid modification time", modifiedSince: "yesterday", expected: false},
+		{name: "unknown modification time", path: "/unknown", modifiedSince: "Tue, 02 Jan 2024 03:04:05 GMT", expected: false},
+		{name: "HEAD request", method: http.MethodHead, noneMatch: `"abc"`, expected: true},
+		{name: "POST request", method: http.MethodPost, noneMatch: `"abc"`, expected: false},
+	}
+
+	for _, test := range tests {
+		var (
+			method string = http.MethodGet
+			path   string = "/"
+		)
+
+		if len(test.method) > 0 {
+			method = test.method
+		}
+
+		if len(test.path) > 0 {
+			path = test.path
+		}
+
+		req := httptest.NewRequest(method, path, nil)
+
+		if len(test.noneMatch) > 0 {
+			req.Header.Set(fiber.HeaderIfNoneMatch, test.noneMatch)
+		}
+
+		if len(test.modifiedSince) > 0 {
+			req.Header.Set(fiber.HeaderIfModifiedSince, test.modifiedSince)
+		}
+
+		resp, err := testApp.Test(req)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if fresh := resp.Header.Get("X-Fresh"); fresh != strconv.FormatBool(test.expected) {
+			t.Fatalf("%s: isFresh returned %s, expected %t", test.name, fresh, test.expected)
+		}
+	}
+}
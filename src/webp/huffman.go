@@ -0,0 +1,170 @@
+package webp
+
+import (
+	"sort"
+)
+
+// maxCodeLength is the longest prefix code allowed by the lossless format.
+const maxCodeLength = 15
+
+// prefixCode is a canonical prefix code built from the histogram of an alphabet.
+type prefixCode struct {
+	Lengths []uint8
+	Codes   []uint16
+	// Symbols is the amount of symbols with a non-zero code length, codes with less than two symbols are written using zero bits.
+	Symbols int
+}
+
+// huffmanNode is a single node used while building a prefix code.
+type huffmanNode struct {
+	Count  int
+	Symbol int
+	Left   *huffmanNode
+	Right  *huffmanNode
+}
+
+// newPrefixCode returns a canonical prefix code for the histogram, where no code is longer than the maximum length.
+func newPrefixCode(histogram []int, maxLength int) prefixCode {
+	result := prefixCode{
+		Lengths: make([]uint8, len(histogram)),
+		Codes:   make([]uint16, len(histogram)),
+	}
+
+	counts := make([]int, len(histogram))
+	copy(counts, histogram)
+
+	for {
+		nodes := make([]*huffmanNode, 0, len(counts))
+
+		for symbol, count := range counts {
+			if count > 0 {
+				nodes = append(nodes, &huffmanNode{Count: count, Symbol: symbol})
+			}
+		}
+
+		result.Symbols = len(nodes)
+
+		if len(nodes) == 0 {
+			return result
+		}
+
+		if len(nodes) == 1 {
+			result.Lengths[nodes[0].Symbol] = 1
+
+			return result
+		}
+
+		// Sort by count and then symbol so the resulting code is deterministic
+		sort.Slice(nodes, func(i, j int) bool {
+			if nodes[i].Count != nodes[j].Count {
+				return nodes[i].Count < nodes[j].Count
+			}
+
+			return nodes[i].Symbol < nodes[j].Symbol
+		})
+
+		// The leaves are sorted, and merged nodes are created in increasing order, so the two smallest nodes are always at the
+		// front of one of the two queues
+		var (
+			leaves []*huffmanNode = nodes
+			merged []*huffmanNode = make([]*huffmanNode, 0, len(nodes))
+		)
+
+		pop := func() *huffmanNode {
+			if len(merged) == 0 || (len(leaves) > 0 && leaves[0].Count <= merged[0].Count) {
+				node := leaves[0]
+				leaves = leaves[1:]
+
+				return node
+			}
+
+			node := merged[0]
+			merged = merged[1:]
+
+			return node
+		}
+
+		for len(leaves)+len(merged) > 1 {
+			left, right := pop(), pop()
+
+			merged = append(merged, &huffmanNode{Count: left.Count + right.Count, Symbol: -1, Left: left, Right: right})
+		}
+
+		if assignLengths(merged[0], 0, result.Lengths) <= maxLength {
+			break
+		}
+
+		// Flatten the histogram and try again until the code fits within the maximum length
+		for symbol, count := range counts {
+			if count > 0 {
+				counts[symbol] = (count + 1) / 2
+			}
+		}
+	}
+
+	// Assign the canonical codes in order of code length, and then symbol
+	var (
+		lengthCounts [maxCodeLength + 1]int
+		nextCodes    [maxCodeLength + 1]int
+		code         int = 0
+	)
+
+	for _, length := range result.Lengths {
+		lengthCounts[length]++
+	}
+
+	lengthCounts[0] = 0
+
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + lengthCounts[length-1]) << 1
+		nextCodes[length] = code
+	}
+
+	for symbol, length := range result.Lengths {
+		if length > 0 {
+			result.Codes[symbol] = reverseBits(uint16(nextCodes[length]), length)
+			nextCodes[length]++
+		}
+	}
+
+	return result
+}
+
+// assignLengths sets the code length of every leaf below the node, and returns the longest code length.
+func assignLengths(node *huffmanNode, depth int, lengths []uint8) int {
+	if node.Left == nil {
+		lengths[node.Symbol] = uint8(depth)
+
+		return depth
+	}
+
+	left := assignLengths(node.Left, depth+1, lengths)
+	right := assignLengths(node.Right, depth+1, lengths)
+
+	if left > right {
+		return left
+	}
+
+	return right
+}
+
+// reverseBits reverses the lowest bits of the code, as prefix codes are read starting from the most significant bit while all
+// other values are read starting from the least significant bit.
+func reverseBits(code uint16, length uint8) uint16 {
+	var result uint16 = 0
+
+	for i := uint8(0); i < length; i++ {
+		result = result<<1 | (code>>i)&1
+	}
+
+	return result
+}
+
+// writeSymbol writes the prefix code of the symbol.
+func (c prefixCode) writeSymbol(w *bitWriter, symbol int) {
+	if c.Symbols < 2 {
+		return
+	}
+
+	w.WriteBits(uint32(c.Codes[symbol]), uint(c.Lengths[symbol]))
+}
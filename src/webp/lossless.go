@@ -0,0 +1,476 @@
+package webp
+
+import (
+	"image"
+)
+
+const (
+	losslessSignature  = 0x2F
+	colorCacheBits     = 10
+	colorCacheSize     = 1 << colorCacheBits
+	colorCacheMultiply = 0x1E35A7BD
+	lengthCodes        = 24
+	distanceCodes      = 40
+	minMatchLength     = 3
+	maxMatchLength     = 4096
+	maxMatchCandidates = 32
+	matchHashBits      = 16
+	// distanceMapOffset is the amount of distance codes reserved for nearby pixels, larger distances are offset by this amount.
+	distanceMapOffset = 120
+)
+
+// codeLengthOrder is the order that the code lengths of the code length code are written in.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter writes values starting from the least significant bit, as used by the lossless format.
+type bitWriter struct {
+	Data  []byte
+	bits  uint64
+	nbits uint
+}
+
+// WriteBits writes the lowest n bits of the value.
+func (w *bitWriter) WriteBits(value uint32, n uint) {
+	w.bits |= uint64(value&(1<<n-1)) << w.nbits
+	w.nbits += n
+
+	for w.nbits >= 8 {
+		w.Data = append(w.Data, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+// Bytes returns the written data, padding the last byte with zero bits.
+func (w *bitWriter) Bytes() []byte {
+	if w.nbits > 0 {
+		return append(w.Data, byte(w.bits))
+	}
+
+	return w.Data
+}
+
+// losslessToken is either a literal pixel, a color cache reference or a backward reference to previously written pixels.
+type losslessToken struct {
+	// Length is the amount of pixels copied by a backward reference, or zero for a literal pixel.
+	Length int
+	// Distance is the distance code of a backward reference, or the color cache index plus one for a cached literal.
+	Distance int
+	Pixel    uint32
+}
+
+// encodeLossless encodes the image into a lossless bitstream, including the header.
+func encodeLossless(img *image.NRGBA) []byte {
+	var (
+		bounds = img.Bounds()
+		width  = bounds.Dx()
+		height = bounds.Dy()
+		pixels = make([]uint32, 0, width*height)
+		alpha  = false
+		w      = &bitWriter{}
+	)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+
+			if c.A != 255 {
+				alpha = true
+			}
+
+			// Fully transparent pixels are stored as transparent black, which compresses better than any leftover color
+			if c.A == 0 {
+				pixels = append(pixels, 0)
+
+				continue
+			}
+
+			// The subtract green transform stores red and blue as the difference from green
+			pixels = append(pixels, uint32(c.A)<<24|uint32(c.R-c.G)<<16|uint32(c.G)<<8|uint32(c.B-c.G))
+		}
+	}
+
+	w.WriteBits(losslessSignature, 8)
+	w.WriteBits(uint32(width-1), 14)
+	w.WriteBits(uint32(height-1), 14)
+
+	if alpha {
+		w.WriteBits(1, 1)
+	} else {
+		w.WriteBits(0, 1)
+	}
+
+	// Version number
+	w.WriteBits(0, 3)
+
+	// A single subtract green transform, followed by the end of the transforms
+	w.WriteBits(1, 1)
+	w.WriteBits(2, 2)
+	w.WriteBits(0, 1)
+
+	writeImageData(w, pixels, width)
+
+	return w.Bytes()
+}
+
+// encodeLosslessAlpha encodes the alpha channel of the image into a lossless bitstream without the header, as used by the
+// alpha chunk of lossy images. The alpha values are stored in the green channel.
+func encodeLosslessAlpha(img *image.NRGBA) []byte {
+	var (
+		bounds = img.Bounds()
+		pixels = make([]uint32, 0, bounds.Dx()*bounds.Dy())
+		w      = &bitWriter{}
+	)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixels = append(pixels, uint32(img.NRGBAAt(x, y).A)<<8)
+		}
+	}
+
+	// No transforms
+	w.WriteBits(0, 1)
+
+	writeImageData(w, pixels, bounds.Dx())
+
+	return w.Bytes()
+}
+
+// writeImageData writes the color cache information, a single group of prefix codes and the entropy-coded pixels.
+func writeImageData(w *bitWriter, pixels []uint32, width int) {
+	var (
+		tokens     = getLosslessTokens(pixels, width)
+		green      = make([]int, 256+lengthCodes+colorCacheSize)
+		red        = make([]int, 256)
+		blue       = make([]int, 256)
+		alpha      = make([]int, 256)
+		distance   = make([]int, distanceCodes)
+		histograms = [][]int{green, red, blue, alpha, distance}
+		codes      = make([]prefixCode, len(histograms))
+	)
+
+	for _, token := range tokens {
+		switch {
+		case token.Length > 0:
+			{
+				lengthCode, _, _ := getPrefixEncoding(token.Length)
+				distanceCode, _, _ := getPrefixEncoding(token.Distance)
+
+				green[256+lengthCode]++
+				distance[distanceCode]++
+
+				break
+			}
+		case token.Distance > 0:
+			{
+				green[256+lengthCodes+token.Distance-1]++
+
+				break
+			}
+		default:
+			{
+				alpha[token.Pixel>>24]++
+				red[(token.Pixel>>16)&0xFF]++
+				green[(token.Pixel>>8)&0xFF]++
+				blue[token.Pixel&0xFF]++
+
+				break
+			}
+		}
+	}
+
+	// Color cache information
+	w.WriteBits(1, 1)
+	w.WriteBits(colorCacheBits, 4)
+
+	// A single prefix code group is used for the entire image
+	w.WriteBits(0, 1)
+
+	for i, histogram := range histograms {
+		codes[i] = newPrefixCode(histogram, maxCodeLength)
+
+		writePrefixCode(w, codes[i])
+	}
+
+	for _, token := range tokens {
+		switch {
+		case token.Length > 0:
+			{
+				lengthCode, lengthBits, lengthExtra := getPrefixEncoding(token.Length)
+				distanceCode, distanceBits, distanceExtra := getPrefixEncoding(token.Distance)
+
+				codes[0].writeSymbol(w, 256+lengthCode)
+				w.WriteBits(lengthExtra, lengthBits)
+				codes[4].writeSymbol(w, distanceCode)
+				w.WriteBits(distanceExtra, distanceBits)
+
+				break
+			}
+		case token.Distance > 0:
+			{
+				codes[0].writeSymbol(w, 256+lengthCodes+token.Distance-1)
+
+				break
+			}
+		default:
+			{
+				codes[0].writeSymbol(w, int((token.Pixel>>8)&0xFF))
+				codes[1].writeSymbol(w, int((token.Pixel>>16)&0xFF))
+				codes[2].writeSymbol(w, int(token.Pixel&0xFF))
+				codes[3].writeSymbol(w, int(token.Pixel>>24))
+
+				break
+			}
+		}
+	}
+}
+
+// getLosslessTokens splits the pixels into literals, color cache references and backward references, using a greedy search
+// for the longest match among the pixel to the left, the pixel above and recent positions with the same hash.
+func getLosslessTokens(pixels []uint32, width int) []losslessToken {
+	var (
+		result = make([]losslessToken, 0)
+		cache  [colorCacheSize]uint32
+		head   = make([]int32, 1<<matchHashBits)
+		chain  = make([]int32, len(pixels))
+	)
+
+	for i := range head {
+		head[i] = -1
+	}
+
+	hash := func(i int) int {
+		return int((pixels[i]*colorCacheMultiply ^ pixels[i+1]) * colorCacheMultiply >> (32 - matchHashBits))
+	}
+
+	insert := func(i int) {
+		if i+1 >= len(pixels) {
+			return
+		}
+
+		h := hash(i)
+		chain[i] = head[h]
+		head[h] = int32(i)
+	}
+
+	matchLength := func(i, j int) int {
+		length := 0
+
+		for i+length < len(pixels) && length < maxMatchLength && pixels[i+length] == pixels[j+length] {
+			length++
+		}
+
+		return length
+	}
+
+	for i := 0; i < len(pixels); {
+		var (
+			bestLength   int = 0
+			bestDistance int = 0
+		)
+
+		// The pixel to the left and the pixel above are checked first as they are the most common matches, and have the shortest
+		// distance codes
+		for _, distance := range []int{1, width} {
+			if distance <= i {
+				if length := matchLength(i, i-distance); length > bestLength {
+					bestLength, bestDistance = length, distance
+				}
+			}
+		}
+
+		if i+1 < len(pixels) {
+			for j, n := head[hash(i)], 0; j >= 0 && n < maxMatchCandidates; j, n = chain[j], n+1 {
+				if length := matchLength(i, int(j)); length > bestLength {
+					bestLength, bestDistance = length, i-int(j)
+				}
+			}
+		}
+
+		if bestLength >= minMatchLength {
+			result = append(result, losslessToken{Length: bestLength, Distance: getDistanceCode(bestDistance, width)})
+
+			for n := 0; n < bestLength; n++ {
+				cache[(pixels[i+n]*colorCacheMultiply)>>(32-colorCacheBits)] = pixels[i+n]
+
+				insert(i + n)
+			}
+
+			i += bestLength
+
+			continue
+		}
+
+		index := (pixels[i] * colorCacheMultiply) >> (32 - colorCacheBits)
+
+		if cache[index] == pixels[i] {
+			result = append(result, losslessToken{Distance: int(index) + 1})
+		} else {
+			result = append(result, losslessToken{Pixel: pixels[i]})
+		}
+
+		cache[index] = pixels[i]
+
+		insert(i)
+
+		i++
+	}
+
+	return result
+}
+
+// getDistanceCode returns the distance code of the distance in pixels. The first distance codes refer to nearby pixels in two
+// dimensions, of which only the pixel to the left and the pixel above are used.
+func getDistanceCode(distance, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	default:
+		return distance + distanceMapOffset
+	}
+}
+
+// getPrefixEncoding returns the prefix code, the amount of extra bits and the value of the extra bits used to store a length
+// or distance code.
+func getPrefixEncoding(value int) (int, uint, uint32) {
+	value--
+
+	if value < 4 {
+		return value, 0, 0
+	}
+
+	highest := 0
+
+	for v := value; v > 1; v >>= 1 {
+		highest++
+	}
+
+	second := (value >> (highest - 1)) & 1
+	bits := uint(highest - 1)
+
+	return 2*highest + second, bits, uint32(value) & (1<<bits - 1)
+}
+
+// writePrefixCode writes the code lengths of the prefix code, using the simple format for codes with at most two symbols that
+// fit within 8 bits.
+func writePrefixCode(w *bitWriter, code prefixCode) {
+	symbols := make([]int, 0, 2)
+
+	for symbol, length := range code.Lengths {
+		if length > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	if len(symbols) == 0 {
+		symbols = append(symbols, 0)
+	}
+
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		w.WriteBits(1, 1)
+		w.WriteBits(uint32(len(symbols)-1), 1)
+
+		if symbols[0] < 2 {
+			w.WriteBits(0, 1)
+			w.WriteBits(uint32(symbols[0]), 1)
+		} else {
+			w.WriteBits(1, 1)
+			w.WriteBits(uint32(symbols[0]), 8)
+		}
+
+		if len(symbols) == 2 {
+			w.WriteBits(uint32(symbols[1]), 8)
+		}
+
+		return
+	}
+
+	var (
+		lengthTokens    = getCodeLengthTokens(code.Lengths)
+		lengthHistogram = make([]int, len(codeLengthOrder))
+	)
+
+	for _, token := range lengthTokens {
+		lengthHistogram[token[0]]++
+	}
+
+	lengthCode := newPrefixCode(lengthHistogram, 7)
+	count := len(codeLengthOrder)
+
+	for count > 4 && lengthCode.Lengths[codeLengthOrder[count-1]] == 0 {
+		count--
+	}
+
+	w.WriteBits(0, 1)
+	w.WriteBits(uint32(count-4), 4)
+
+	for _, symbol := range codeLengthOrder[:count] {
+		w.WriteBits(uint32(lengthCode.Lengths[symbol]), 3)
+	}
+
+	// The code lengths of every symbol in the alphabet are written
+	w.WriteBits(0, 1)
+
+	for _, token := range lengthTokens {
+		lengthCode.writeSymbol(w, token[0])
+
+		switch token[0] {
+		case 16:
+			w.WriteBits(uint32(token[1]-3), 2)
+		case 17:
+			w.WriteBits(uint32(token[1]-3), 3)
+		case 18:
+			w.WriteBits(uint32(token[1]-11), 7)
+		}
+	}
+}
+
+// getCodeLengthTokens returns the code lengths as pairs of code length symbols and repeat counts, where runs of zeros and
+// repeated lengths are shortened using the repeat symbols.
+func getCodeLengthTokens(lengths []uint8) [][2]int {
+	var (
+		result   = make([][2]int, 0)
+		previous = 8
+	)
+
+	for i := 0; i < len(lengths); {
+		length := int(lengths[i])
+		run := 1
+
+		for i+run < len(lengths) && int(lengths[i+run]) == length {
+			run++
+		}
+
+		i += run
+
+		if length == 0 {
+			for ; run >= 11; run -= 138 {
+				result = append(result, [2]int{18, min(run, 138)})
+			}
+
+			if run >= 3 {
+				result = append(result, [2]int{17, run})
+				run = 0
+			}
+		} else {
+			// Only a length equal to the previous non-zero length can be repeated
+			if length != previous {
+				result = append(result, [2]int{length, 0})
+				previous = length
+				run--
+			}
+
+			for ; run >= 3; run -= 6 {
+				result = append(result, [2]int{16, min(run, 6)})
+			}
+		}
+
+		for ; run > 0; run-- {
+			result = append(result, [2]int{length, 0})
+		}
+	}
+
+	return result
+}
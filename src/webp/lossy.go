@@ -0,0 +1,858 @@
+package webp
+
+import (
+	"image"
+)
+
+// The prediction modes of 16x16 luma and 8x8 chroma blocks.
+const (
+	predictionDC = iota
+	predictionTM
+	predictionVE
+	predictionHE
+)
+
+// boolWriter writes boolean values using the arithmetic coder of the lossy format, as specified in section 7.3 of RFC 6386.
+type boolWriter struct {
+	Data     []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+// newBoolWriter returns a new boolean arithmetic coder.
+func newBoolWriter() *boolWriter {
+	return &boolWriter{
+		rng:      255,
+		bitCount: 24,
+	}
+}
+
+// WriteBool writes the bit, where the probability is the chance out of 256 that the bit is false.
+func (w *boolWriter) WriteBool(probability uint8, bit bool) {
+	split := 1 + ((w.rng-1)*uint32(probability))>>8
+
+	if bit {
+		w.bottom += split
+		w.rng -= split
+	} else {
+		w.rng = split
+	}
+
+	for w.rng < 128 {
+		w.rng <<= 1
+
+		if w.bottom&(1<<31) != 0 {
+			w.carry()
+		}
+
+		w.bottom <<= 1
+		w.bitCount--
+
+		if w.bitCount == 0 {
+			w.Data = append(w.Data, byte(w.bottom>>24))
+			w.bottom &= 1<<24 - 1
+			w.bitCount = 8
+		}
+	}
+}
+
+// WriteLiteral writes the lowest n bits of the value with even probability, starting from the most significant bit.
+func (w *boolWriter) WriteLiteral(value uint32, n int) {
+	for n > 0 {
+		n--
+
+		w.WriteBool(128, (value>>n)&1 == 1)
+	}
+}
+
+// Bytes flushes the remaining state of the coder and returns the written data.
+func (w *boolWriter) Bytes() []byte {
+	var (
+		c = w.bitCount
+		v = w.bottom
+	)
+
+	if v&(1<<(32-c)) != 0 {
+		w.carry()
+	}
+
+	v <<= c & 7
+
+	for c >>= 3; c > 0; c-- {
+		v <<= 8
+	}
+
+	for i := 0; i < 4; i++ {
+		w.Data = append(w.Data, byte(v>>24))
+		v <<= 8
+	}
+
+	return w.Data
+}
+
+// carry propagates an overflow of the lowest value into the already written data.
+func (w *boolWriter) carry() {
+	i := len(w.Data) - 1
+
+	for i >= 0 && w.Data[i] == 255 {
+		w.Data[i] = 0
+		i--
+	}
+
+	if i >= 0 {
+		w.Data[i]++
+	}
+}
+
+// plane is a single 8-bit color plane, padded to a multiple of the macroblock size.
+type plane struct {
+	Pix    []uint8
+	Stride int
+}
+
+// At returns the value at the position.
+func (p *plane) At(x, y int) int32 {
+	return int32(p.Pix[y*p.Stride+x])
+}
+
+// nonZeroContext stores whether the blocks along the edge of a macroblock had any non-zero coefficients, which is used to
+// select the token probabilities of the neighboring blocks.
+type nonZeroContext struct {
+	Y  [4]uint8
+	U  [2]uint8
+	V  [2]uint8
+	Y2 uint8
+}
+
+// lossyEncoder encodes an image into the lossy format, using 16x16 luma prediction for every macroblock.
+type lossyEncoder struct {
+	width   int
+	height  int
+	mbw     int
+	mbh     int
+	source  [3]plane
+	output  [3]plane
+	qIndex  int
+	y1Quant [2]int32
+	y2Quant [2]int32
+	uvQuant [2]int32
+	header  *boolWriter
+	tokens  *boolWriter
+	top     []nonZeroContext
+	left    nonZeroContext
+}
+
+// encodeLossy encodes the color of the image into a lossy bitstream, ignoring the alpha channel. The quality ranges from 0 to
+// 100, where higher values use a lower quantizer.
+func encodeLossy(img *image.NRGBA, quality int) []byte {
+	bounds := img.Bounds()
+
+	e := &lossyEncoder{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		mbw:    (bounds.Dx() + 15) / 16,
+		mbh:    (bounds.Dy() + 15) / 16,
+		qIndex: (100 - clamp(quality, 0, 100)) * 127 / 100,
+		header: newBoolWriter(),
+		tokens: newBoolWriter(),
+	}
+
+	e.y1Quant = [2]int32{dcQuantizers[e.qIndex], acQuantizers[e.qIndex]}
+	e.y2Quant = [2]int32{dcQuantizers[e.qIndex] * 2, acQuantizers[e.qIndex] * 155 / 100}
+	e.uvQuant = [2]int32{dcQuantizers[min(e.qIndex, 117)], acQuantizers[e.qIndex]}
+
+	if e.y2Quant[1] < 8 {
+		e.y2Quant[1] = 8
+	}
+
+	e.convertColors(img)
+	e.writeHeader()
+
+	e.top = make([]nonZeroContext, e.mbw)
+
+	for mby := 0; mby < e.mbh; mby++ {
+		e.left = nonZeroContext{}
+
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+
+	var (
+		first  = e.header.Bytes()
+		tokens = e.tokens.Bytes()
+		tag    = uint32(1<<4) | uint32(len(first))<<5
+		result = make([]byte, 0, 10+len(first)+len(tokens))
+	)
+
+	// Frame tag of a key frame, followed by the start code and dimensions
+	result = append(result, byte(tag), byte(tag>>8), byte(tag>>16))
+	result = append(result, 0x9D, 0x01, 0x2A)
+	result = append(result, byte(e.width), byte(e.width>>8), byte(e.height), byte(e.height>>8))
+	result = append(result, first...)
+	result = append(result, tokens...)
+
+	return result
+}
+
+// convertColors converts the image into the Y'CbCr color planes with 4:2:0 chroma subsampling. The color of transparent pixels
+// is replaced by the average color of the visible pixels within the same macroblock, which avoids artifacts along the edges of
+// visible areas, and the planes are padded by repeating the last row and column of pixels.
+func (e *lossyEncoder) convertColors(img *image.NRGBA) {
+	var (
+		bounds = img.Bounds()
+		width  = e.mbw * 16
+		height = e.mbh * 16
+		pixels = make([][3]int32, width*height)
+	)
+
+	for mby := 0; mby < e.mbh; mby++ {
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			var (
+				sum   [3]int32
+				count int32
+			)
+
+			for y := mby * 16; y < mby*16+16 && y < e.height; y++ {
+				for x := mbx * 16; x < mbx*16+16 && x < e.width; x++ {
+					if c := img.NRGBAAt(bounds.Min.X+x, bounds.Min.Y+y); c.A > 0 {
+						sum[0] += int32(c.R)
+						sum[1] += int32(c.G)
+						sum[2] += int32(c.B)
+						count++
+					}
+				}
+			}
+
+			if count > 0 {
+				sum[0], sum[1], sum[2] = sum[0]/count, sum[1]/count, sum[2]/count
+			}
+
+			for y := mby * 16; y < mby*16+16; y++ {
+				for x := mbx * 16; x < mbx*16+16; x++ {
+					c := img.NRGBAAt(bounds.Min.X+min(x, e.width-1), bounds.Min.Y+min(y, e.height-1))
+
+					if c.A == 0 {
+						pixels[y*width+x] = sum
+					} else {
+						pixels[y*width+x] = [3]int32{int32(c.R), int32(c.G), int32(c.B)}
+					}
+				}
+			}
+		}
+	}
+
+	e.source[0] = plane{Pix: make([]uint8, width*height), Stride: width}
+	e.source[1] = plane{Pix: make([]uint8, width*height/4), Stride: width / 2}
+	e.source[2] = plane{Pix: make([]uint8, width*height/4), Stride: width / 2}
+
+	for i := range e.output {
+		e.output[i] = plane{Pix: make([]uint8, len(e.source[i].Pix)), Stride: e.source[i].Stride}
+	}
+
+	// The conversion uses the same fixed-point BT.601 coefficients as the reference encoder
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := pixels[y*width+x]
+
+			e.source[0].Pix[y*width+x] = uint8((16839*p[0] + 33059*p[1] + 6420*p[2] + 16<<16 + 1<<15) >> 16)
+		}
+	}
+
+	for y := 0; y < height/2; y++ {
+		for x := 0; x < width/2; x++ {
+			var r, g, b int32
+
+			for _, p := range [][3]int32{pixels[2*y*width+2*x], pixels[2*y*width+2*x+1], pixels[(2*y+1)*width+2*x], pixels[(2*y+1)*width+2*x+1]} {
+				r, g, b = r+p[0], g+p[1], b+p[2]
+			}
+
+			e.source[1].Pix[y*width/2+x] = clip8((-9719*r - 19081*g + 28800*b + 128<<18 + 1<<17) >> 18)
+			e.source[2].Pix[y*width/2+x] = clip8((28800*r - 24116*g - 4684*b + 128<<18 + 1<<17) >> 18)
+		}
+	}
+}
+
+// writeHeader writes the frame header into the first partition. No segmentation, loop filter or token probability updates are
+// used, and a single partition is used for all coefficient tokens.
+func (e *lossyEncoder) writeHeader() {
+	// Color space and clamping type
+	e.header.WriteLiteral(0, 1)
+	e.header.WriteLiteral(0, 1)
+
+	// Segmentation
+	e.header.WriteLiteral(0, 1)
+
+	// Loop filter type, level and sharpness, without any adjustments
+	e.header.WriteLiteral(0, 1)
+	e.header.WriteLiteral(0, 6)
+	e.header.WriteLiteral(0, 3)
+	e.header.WriteLiteral(0, 1)
+
+	// A single token partition
+	e.header.WriteLiteral(0, 2)
+
+	// Quantizer index, without any deltas
+	e.header.WriteLiteral(uint32(e.qIndex), 7)
+
+	for i := 0; i < 5; i++ {
+		e.header.WriteLiteral(0, 1)
+	}
+
+	// Refresh entropy probabilities
+	e.header.WriteLiteral(0, 1)
+
+	for i := range tokenUpdateProbabilities {
+		for j := range tokenUpdateProbabilities[i] {
+			for k := range tokenUpdateProbabilities[i][j] {
+				for l := range tokenUpdateProbabilities[i][j][k] {
+					e.header.WriteBool(tokenUpdateProbabilities[i][j][k][l], false)
+				}
+			}
+		}
+	}
+
+	// Macroblocks without coefficients are not skipped
+	e.header.WriteLiteral(0, 1)
+}
+
+// encodeMacroblock chooses the prediction mode of the macroblock, writes the mode and the quantized residuals, and stores the
+// reconstructed pixels that later macroblocks are predicted from.
+func (e *lossyEncoder) encodeMacroblock(mbx, mby int) {
+	var (
+		lumaMode, lumaPrediction     = e.choosePrediction(mbx, mby, 16, e.source[0:1], e.output[0:1])
+		chromaMode, chromaPrediction = e.choosePrediction(mbx, mby, 8, e.source[1:3], e.output[1:3])
+	)
+
+	// Luma mode, using 16x16 prediction
+	e.header.WriteBool(145, true)
+
+	switch lumaMode {
+	case predictionDC:
+		e.header.WriteBool(156, false)
+		e.header.WriteBool(163, false)
+	case predictionVE:
+		e.header.WriteBool(156, false)
+		e.header.WriteBool(163, true)
+	case predictionHE:
+		e.header.WriteBool(156, true)
+		e.header.WriteBool(128, false)
+	case predictionTM:
+		e.header.WriteBool(156, true)
+		e.header.WriteBool(128, true)
+	}
+
+	// Chroma mode
+	e.header.WriteBool(142, chromaMode != predictionDC)
+
+	if chromaMode != predictionDC {
+		e.header.WriteBool(114, chromaMode != predictionVE)
+
+		if chromaMode != predictionVE {
+			e.header.WriteBool(183, chromaMode != predictionHE)
+		}
+	}
+
+	var (
+		top       = &e.top[mbx]
+		blocks    [16][16]int32
+		dcLevels  [16]int32
+		residuals [16][16]int16
+	)
+
+	// Transform the luma residuals, where the DC coefficients of all blocks are transformed again as a separate block
+	for n := 0; n < 16; n++ {
+		var input [16]int32
+
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				px, py := mbx*16+(n%4)*4+x, mby*16+(n/4)*4+y
+
+				input[y*4+x] = e.source[0].At(px, py) - int32(lumaPrediction[0][((n/4)*4+y)*16+(n%4)*4+x])
+			}
+		}
+
+		blocks[n] = forwardDCT(input)
+		dcLevels[n] = blocks[n][0]
+	}
+
+	y2 := forwardWHT(dcLevels)
+
+	for i := range y2 {
+		y2[i] = quantize(y2[i], e.y2Quant[btoi(i > 0)], i > 0)
+	}
+
+	nz := e.writeCoefficients(planeY2, int(e.left.Y2+top.Y2), y2, 0)
+	e.left.Y2, top.Y2 = nz, nz
+
+	// The decoded DC coefficients of each block come from the inverse transform of the quantized coefficients
+	{
+		var dequantized [16]int16
+
+		for i, level := range y2 {
+			dequantized[i] = int16(level * e.y2Quant[btoi(i > 0)])
+		}
+
+		dc := inverseWHT(dequantized)
+
+		for n := range residuals {
+			residuals[n][0] = dc[n]
+		}
+	}
+
+	for n := 0; n < 16; n++ {
+		x, y := n%4, n/4
+
+		for i := 1; i < 16; i++ {
+			blocks[n][i] = quantize(blocks[n][i], e.y1Quant[1], true)
+			residuals[n][i] = int16(blocks[n][i] * e.y1Quant[1])
+		}
+
+		nz := e.writeCoefficients(planeY1WithY2, int(e.left.Y[y]+top.Y[x]), blocks[n], 1)
+		e.left.Y[y], top.Y[x] = nz, nz
+
+		e.reconstruct(&e.output[0], lumaPrediction[0], 16, mbx*16, mby*16, x*4, y*4, residuals[n])
+	}
+
+	// Transform the chroma residuals of both chroma planes
+	for p := 1; p < 3; p++ {
+		left, above := &e.left.U, &top.U
+
+		if p == 2 {
+			left, above = &e.left.V, &top.V
+		}
+
+		for n := 0; n < 4; n++ {
+			var (
+				x, y     = n % 2, n / 2
+				input    [16]int32
+				residual [16]int16
+			)
+
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					input[j*4+i] = e.source[p].At(mbx*8+x*4+i, mby*8+y*4+j) - int32(chromaPrediction[p-1][(y*4+j)*8+x*4+i])
+				}
+			}
+
+			coefficients := forwardDCT(input)
+
+			for i := range coefficients {
+				coefficients[i] = quantize(coefficients[i], e.uvQuant[btoi(i > 0)], i > 0)
+				residual[i] = int16(coefficients[i] * e.uvQuant[btoi(i > 0)])
+			}
+
+			nz := e.writeCoefficients(planeUV, int(left[y]+above[x]), coefficients, 0)
+			left[y], above[x] = nz, nz
+
+			e.reconstruct(&e.output[p], chromaPrediction[p-1], 8, mbx*8, mby*8, x*4, y*4, residual)
+		}
+	}
+}
+
+// choosePrediction returns the prediction mode with the lowest error across the planes, and the predicted values of each plane
+// using that mode. The size is the width and height of the block within each plane.
+func (e *lossyEncoder) choosePrediction(mbx, mby, size int, source, output []plane) (int, [][]uint8) {
+	var (
+		bestMode       int       = predictionDC
+		bestError      int64     = -1
+		bestPrediction [][]uint8 = nil
+	)
+
+	for _, mode := range []int{predictionDC, predictionTM, predictionVE, predictionHE} {
+		var (
+			prediction = make([][]uint8, len(source))
+			err        int64
+		)
+
+		for i := range source {
+			prediction[i] = predict(&output[i], mode, mbx, mby, size)
+
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					d := int64(source[i].At(mbx*size+x, mby*size+y)) - int64(prediction[i][y*size+x])
+					err += d * d
+				}
+			}
+		}
+
+		if bestError < 0 || err < bestError {
+			bestMode, bestError, bestPrediction = mode, err, prediction
+		}
+	}
+
+	return bestMode, bestPrediction
+}
+
+// predict returns the predicted values of the block using the mode, based on the reconstructed values above and to the left of
+// the block. Values outside of the image are 127 above the block and 129 to the left of the block, and DC prediction only uses
+// the edges that are within the image.
+func predict(p *plane, mode, mbx, mby, size int) []uint8 {
+	var (
+		result = make([]uint8, size*size)
+		above  = make([]int32, size)
+		left   = make([]int32, size)
+		corner int32
+		x0, y0 = mbx * size, mby * size
+	)
+
+	for i := 0; i < size; i++ {
+		above[i], left[i] = 127, 129
+
+		if mby > 0 {
+			above[i] = p.At(x0+i, y0-1)
+		}
+
+		if mbx > 0 {
+			left[i] = p.At(x0-1, y0+i)
+		}
+	}
+
+	switch {
+	case mby == 0:
+		corner = 127
+	case mbx == 0:
+		corner = 129
+	default:
+		corner = p.At(x0-1, y0-1)
+	}
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var value int32
+
+			switch mode {
+			case predictionTM:
+				value = left[y] + above[x] - corner
+			case predictionVE:
+				value = above[x]
+			case predictionHE:
+				value = left[y]
+			default:
+				{
+					var (
+						sum   int32 = 0
+						count int32 = 0
+					)
+
+					if mby > 0 {
+						for _, v := range above {
+							sum += v
+						}
+
+						count += int32(size)
+					}
+
+					if mbx > 0 {
+						for _, v := range left {
+							sum += v
+						}
+
+						count += int32(size)
+					}
+
+					value = 128
+
+					if count > 0 {
+						value = (sum + count/2) / count
+					}
+				}
+			}
+
+			result[y*size+x] = clip8(value)
+		}
+	}
+
+	return result
+}
+
+// reconstruct adds the inverse transform of the dequantized residual to the predicted values of a 4x4 block, and stores the
+// result in the output plane.
+func (e *lossyEncoder) reconstruct(output *plane, prediction []uint8, size, x0, y0, bx, by int, residual [16]int16) {
+	values := inverseDCT(residual)
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			output.Pix[(y0+by+y)*output.Stride+x0+bx+x] = clip8(int32(prediction[(by+y)*size+bx+x]) + values[y*4+x])
+		}
+	}
+}
+
+// writeCoefficients writes the tokens of the quantized coefficients of a block, starting at the first coefficient in zigzag
+// order, and returns 1 if any coefficient was written.
+func (e *lossyEncoder) writeCoefficients(planeType, context int, coefficients [16]int32, first int) uint8 {
+	var (
+		probabilities = &defaultTokenProbabilities[planeType]
+		last          = -1
+	)
+
+	for i := first; i < 16; i++ {
+		if coefficients[zigzag[i]] != 0 {
+			last = i
+		}
+	}
+
+	p := probabilities[coefficientBands[first]][context]
+
+	if last < 0 {
+		e.tokens.WriteBool(p[0], false)
+
+		return 0
+	}
+
+	e.tokens.WriteBool(p[0], true)
+
+	for i := first; i <= last; {
+		value := coefficients[zigzag[i]]
+		i++
+
+		if value == 0 {
+			e.tokens.WriteBool(p[1], false)
+			p = probabilities[coefficientBands[i]][0]
+
+			continue
+		}
+
+		e.tokens.WriteBool(p[1], true)
+
+		negative := value < 0
+
+		if negative {
+			value = -value
+		}
+
+		if value == 1 {
+			e.tokens.WriteBool(p[2], false)
+			p = probabilities[coefficientBands[i]][1]
+		} else {
+			e.tokens.WriteBool(p[2], true)
+
+			switch {
+			case value <= 4:
+				{
+					e.tokens.WriteBool(p[3], false)
+					e.tokens.WriteBool(p[4], value != 2)
+
+					if value != 2 {
+						e.tokens.WriteBool(p[5], value == 4)
+					}
+				}
+			case value <= 10:
+				{
+					e.tokens.WriteBool(p[3], true)
+					e.tokens.WriteBool(p[6], false)
+					e.tokens.WriteBool(p[7], value > 6)
+
+					if value <= 6 {
+						e.tokens.WriteBool(159, value == 6)
+					} else {
+						e.tokens.WriteBool(165, (value-7)&2 != 0)
+						e.tokens.WriteBool(145, (value-7)&1 != 0)
+					}
+				}
+			default:
+				{
+					category := 0
+
+					for category < 3 && value >= 3+(16<<category) {
+						category++
+					}
+
+					e.tokens.WriteBool(p[3], true)
+					e.tokens.WriteBool(p[6], true)
+					e.tokens.WriteBool(p[8], category >= 2)
+					e.tokens.WriteBool(p[9+category/2], category&1 != 0)
+
+					var (
+						extra = value - 3 - (8 << category)
+						bits  = categoryProbabilities[category]
+					)
+
+					for j, probability := range bits {
+						e.tokens.WriteBool(probability, (extra>>(len(bits)-1-j))&1 != 0)
+					}
+				}
+			}
+
+			p = probabilities[coefficientBands[i]][2]
+		}
+
+		e.tokens.WriteBool(128, negative)
+
+		if i == 16 {
+			break
+		}
+
+		e.tokens.WriteBool(p[0], i <= last)
+	}
+
+	return 1
+}
+
+// quantize returns the quantized level of the coefficient. AC coefficients are rounded towards zero slightly more than DC
+// coefficients, as small high frequency details are the least noticeable.
+func quantize(coefficient, quantizer int32, ac bool) int32 {
+	var (
+		bias  = quantizer / 2
+		level int32
+	)
+
+	if ac {
+		bias = quantizer * 3 / 8
+	}
+
+	if coefficient < 0 {
+		level = -((-coefficient + bias) / quantizer)
+	} else {
+		level = (coefficient + bias) / quantizer
+	}
+
+	return int32(clamp(int(level), -2048, 2048))
+}
+
+// forwardDCT returns the transformed coefficients of the 4x4 block of residuals.
+func forwardDCT(input [16]int32) [16]int32 {
+	var (
+		temp   [16]int32
+		result [16]int32
+	)
+
+	for i := 0; i < 4; i++ {
+		a := (input[i*4+0] + input[i*4+3]) * 8
+		b := (input[i*4+1] + input[i*4+2]) * 8
+		c := (input[i*4+1] - input[i*4+2]) * 8
+		d := (input[i*4+0] - input[i*4+3]) * 8
+
+		temp[i*4+0] = a + b
+		temp[i*4+2] = a - b
+		temp[i*4+1] = (c*2217 + d*5352 + 14500) >> 12
+		temp[i*4+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+
+	for i := 0; i < 4; i++ {
+		a := temp[i] + temp[12+i]
+		b := temp[4+i] + temp[8+i]
+		c := temp[4+i] - temp[8+i]
+		d := temp[i] - temp[12+i]
+
+		result[i] = (a + b + 7) >> 4
+		result[8+i] = (a - b + 7) >> 4
+		result[4+i] = (c*2217+d*5352+12000)>>16 + btoi(d != 0)
+		result[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+
+	return result
+}
+
+// forwardWHT returns the Walsh-Hadamard transform of the DC coefficients of the 16 luma blocks.
+func forwardWHT(input [16]int32) [16]int32 {
+	var (
+		temp   [16]int32
+		result [16]int32
+	)
+
+	for i := 0; i < 4; i++ {
+		a := (input[i*4+0] + input[i*4+2]) * 4
+		d := (input[i*4+1] + input[i*4+3]) * 4
+		c := (input[i*4+1] - input[i*4+3]) * 4
+		b := (input[i*4+0] - input[i*4+2]) * 4
+
+		temp[i*4+0] = a + d + btoi(a != 0)
+		temp[i*4+1] = b + c
+		temp[i*4+2] = b - c
+		temp[i*4+3] = a - d
+	}
+
+	for i := 0; i < 4; i++ {
+		a := temp[i] + temp[8+i]
+		d := temp[4+i] + temp[12+i]
+		c := temp[4+i] - temp[12+i]
+		b := temp[i] - temp[8+i]
+
+		values := [4]int32{a + d, b + c, b - c, a - d}
+
+		for j, v := range values {
+			if v < 0 {
+				v++
+			}
+
+			result[j*4+i] = (v + 3) >> 3
+		}
+	}
+
+	return result
+}
+
+// inverseDCT returns the residuals of the 4x4 block from the dequantized coefficients, exactly as computed by the decoder.
+func inverseDCT(coefficients [16]int16) [16]int32 {
+	const (
+		c1 = 85627
+		c2 = 35468
+	)
+
+	var (
+		temp   [4][4]int32
+		result [16]int32
+	)
+
+	for i := 0; i < 4; i++ {
+		a := int32(coefficients[i]) + int32(coefficients[8+i])
+		b := int32(coefficients[i]) - int32(coefficients[8+i])
+		c := (int32(coefficients[4+i])*c2)>>16 - (int32(coefficients[12+i])*c1)>>16
+		d := (int32(coefficients[4+i])*c1)>>16 + (int32(coefficients[12+i])*c2)>>16
+
+		temp[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+
+	for j := 0; j < 4; j++ {
+		dc := temp[0][j] + 4
+		a := dc + temp[2][j]
+		b := dc - temp[2][j]
+		c := (temp[1][j]*c2)>>16 - (temp[3][j]*c1)>>16
+		d := (temp[1][j]*c1)>>16 + (temp[3][j]*c2)>>16
+
+		result[j*4+0] = (a + d) >> 3
+		result[j*4+1] = (b + c) >> 3
+		result[j*4+2] = (b - c) >> 3
+		result[j*4+3] = (a - d) >> 3
+	}
+
+	return result
+}
+
+// inverseWHT returns the DC coefficients of the 16 luma blocks from the dequantized coefficients, exactly as computed by the
+// decoder.
+func inverseWHT(coefficients [16]int16) [16]int16 {
+	var (
+		temp   [16]int32
+		result [16]int16
+	)
+
+	for i := 0; i < 4; i++ {
+		a0 := int32(coefficients[i]) + int32(coefficients[12+i])
+		a1 := int32(coefficients[4+i]) + int32(coefficients[8+i])
+		a2 := int32(coefficients[4+i]) - int32(coefficients[8+i])
+		a3 := int32(coefficients[i]) - int32(coefficients[12+i])
+
+		temp[i] = a0 + a1
+		temp[8+i] = a0 - a1
+		temp[4+i] = a3 + a2
+		temp[12+i] = a3 - a2
+	}
+
+	for i := 0; i < 4; i++ {
+		dc := temp[i*4] + 3
+		a0 := dc + temp[i*4+3]
+		a1 := temp[i*4+1] + temp[i*4+2]
+		a2 := temp[i*4+1] - temp[i*4+2]
+		a3 := dc - temp[i*4+3]
+
+		result[i*4+0] = int16((a0 + a1) >> 3)
+		result[i*4+1] = int16((a3 + a2) >> 3)
+		result[i*4+2] = int16((a0 - a1) >> 3)
+		result[i*4+3] = int16((a3 - a2) >> 3)
+	}
+
+	return result
+}
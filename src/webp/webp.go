@@ -0,0 +1,148 @@
+// Package webp implements a WebP image encoder, supporting both the lossless format and the lossy format with a lossless alpha
+// channel.
+//
+// The encoder is written natively because golang.org/x/image/webp can only decode, and the existing lossy encoders either bind
+// libwebp through cgo, which breaks the cross-compiled builds of the Makefile, or run libwebp compiled to WebAssembly inside an
+// embedded runtime. The lossy encoder is deliberately minimal, using only whole-macroblock prediction, a single segment, the
+// default token probabilities and no loop filter, which trades some compression for less code. The tests decode every encoded
+// image with golang.org/x/image/webp.
+package webp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+const (
+	// DefaultQuality is the default quality of lossy images.
+	DefaultQuality = 75
+	// maxDimension is the largest width or height supported by both formats.
+	maxDimension = 1 << 14
+)
+
+// Options are the encoding parameters. Quality ranges from 0 to 100 inclusive, higher is better, and is ignored by lossless
+// images.
+type Options struct {
+	Lossless bool
+	Quality  int
+}
+
+// Encode writes the image to the writer in WebP format. A nil options value uses lossy encoding with the default quality.
+func Encode(w io.Writer, img image.Image, opts *Options) error {
+	if opts == nil {
+		opts = &Options{Quality: DefaultQuality}
+	}
+
+	bounds := img.Bounds()
+
+	if bounds.Dx() < 1 || bounds.Dy() < 1 || bounds.Dx() > maxDimension || bounds.Dy() > maxDimension {
+		return errors.New("webp: invalid image size")
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+
+	if !ok {
+		nrgba = image.NewNRGBA(bounds)
+
+		draw.Draw(nrgba, bounds, img, bounds.Min, draw.Src)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if opts.Lossless {
+		writeChunk(buf, "VP8L", encodeLossless(nrgba))
+	} else {
+		if !nrgba.Opaque() {
+			// The extended header marks the image as having an alpha channel, which is stored losslessly in its own chunk
+			header := make([]byte, 10)
+			header[0] = 0x10
+			putUint24(header[4:], uint32(bounds.Dx()-1))
+			putUint24(header[7:], uint32(bounds.Dy()-1))
+
+			writeChunk(buf, "VP8X", header)
+
+			// Lossless compression of the alpha values, without any filtering or pre-processing
+			writeChunk(buf, "ALPH", append([]byte{0x01}, encodeLosslessAlpha(nrgba)...))
+		}
+
+		writeChunk(buf, "VP8 ", encodeLossy(nrgba, opts.Quality))
+	}
+
+	header := make([]byte, 12)
+	copy(header[0:4], "RIFF")
+	putUint32(header[4:], uint32(4+buf.Len()))
+	copy(header[8:12], "WEBP")
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// writeChunk writes the RIFF chunk to the buffer, padding the data to an even length.
+func writeChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	header := make([]byte, 8)
+	copy(header[0:4], fourCC)
+	putUint32(header[4:], uint32(len(data)))
+
+	buf.Write(header)
+	buf.Write(data)
+
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func putUint24(data []byte, value uint32) {
+	data[0], data[1], data[2] = byte(value), byte(value>>8), byte(value>>16)
+}
+
+func putUint32(data []byte, value uint32) {
+	data[0], data[1], data[2], data[3] = byte(value), byte(value>>8), byte(value>>16), byte(value>>24)
+}
+
+func clamp(value, min, max int) int {
+	if value > max {
+		return max
+	}
+
+	if value < min {
+		return min
+	}
+
+	return value
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func clip8(value int32) uint8 {
+	if value < 0 {
+		return 0
+	}
+
+	if value > 255 {
+		return 255
+	}
+
+	return uint8(value)
+}
+
+func btoi(value bool) int32 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
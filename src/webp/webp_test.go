@@ -0,0 +1,148 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+// testImage returns an image with smooth gradients, flat areas, noise and varying alpha, similar to the contents of renders.
+func testImage(width, height int, opaque bool) *image.NRGBA {
+	var (
+		img *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, width, height))
+		rng *rand.Rand   = rand.New(rand.NewSource(1))
+	)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255}
+
+			if x > width/2 {
+				c = color.NRGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255}
+			}
+
+			if !opaque && y > height/2 {
+				c.A = uint8((x + y) * 16 % 256)
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestLosslessRoundTrip(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {7, 3}, {64, 64}, {300, 173}}
+
+	for _, size := range sizes {
+		for _, opaque := range []bool{true, false} {
+			src := testImage(size[0], size[1], opaque)
+			buf := &bytes.Buffer{}
+
+			if err := Encode(buf, src, &Options{Lossless: true}); err != nil {
+				t.Fatalf("%dx%d: encode: %v", size[0], size[1], err)
+			}
+
+			decoded, err := xwebp.Decode(buf)
+
+			if err != nil {
+				t.Fatalf("%dx%d: decode: %v", size[0], size[1], err)
+			}
+
+			if decoded.Bounds() != src.Bounds() {
+				t.Fatalf("%dx%d: decoded bounds %v", size[0], size[1], decoded.Bounds())
+			}
+
+			for y := 0; y < size[1]; y++ {
+				for x := 0; x < size[0]; x++ {
+					want := src.NRGBAAt(x, y)
+					got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+
+					// Fully transparent pixels are intentionally stored as transparent black
+					if want.A == 0 {
+						want = color.NRGBA{}
+					}
+
+					if got != want {
+						t.Fatalf("%dx%d opaque=%t: pixel (%d, %d) is %v, expected %v", size[0], size[1], opaque, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLossyRoundTrip(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {7, 3}, {64, 64}, {300, 173}}
+
+	for _, size := range sizes {
+		for _, opaque := range []bool{true, false} {
+			for _, quality := range []int{1, 50, 90, 100} {
+				src := testImage(size[0], size[1], opaque)
+				buf := &bytes.Buffer{}
+
+				if err := Encode(buf, src, &Options{Quality: quality}); err != nil {
+					t.Fatalf("%dx%d q%d: encode: %v", size[0], size[1], quality, err)
+				}
+
+				decoded, err := xwebp.Decode(buf)
+
+				if err != nil {
+					t.Fatalf("%dx%d q%d: decode: %v", size[0], size[1], quality, err)
+				}
+
+				if decoded.Bounds() != src.Bounds() {
+					t.Fatalf("%dx%d q%d: decoded bounds %v", size[0], size[1], quality, decoded.Bounds())
+				}
+
+				var totalError int
+
+				for y := 0; y < size[1]; y++ {
+					for x := 0; x < size[0]; x++ {
+						want := src.NRGBAAt(x, y)
+						got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+
+						// The alpha channel is always stored losslessly
+						if got.A != want.A {
+							t.Fatalf("%dx%d q%d: alpha of (%d, %d) is %d, expected %d", size[0], size[1], quality, x, y, got.A, want.A)
+						}
+
+						// The color of mostly transparent pixels is imprecise once the alpha is multiplied back out
+						if want.A > 128 && x <= size[0]/2 {
+							totalError += abs(int(got.R)-int(want.R)) + abs(int(got.G)-int(want.G)) + abs(int(got.B)-int(want.B))
+						}
+					}
+				}
+
+				// Chroma subsampling blurs the steep gradients of tiny images, so only larger images are compared by color
+				if size[0] < 16 || size[1] < 16 {
+					continue
+				}
+
+				// The smooth half of the image must resemble the source at any quality, and closely at high quality
+				limit := 16
+
+				if quality >= 90 {
+					limit = 8
+				}
+
+				if pixels := (size[0]/2 + 1) * size[1]; totalError/(pixels*3) > limit {
+					t.Errorf("%dx%d q%d opaque=%t: mean error %d is above %d", size[0], size[1], quality, opaque, totalError/(pixels*3), limit)
+				}
+			}
+		}
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}